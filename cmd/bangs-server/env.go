@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv returns the environment variable key, or fallback if it is unset.
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("Invalid boolean value in environment variables", "env", key, "value", value)
+			return fallback
+		}
+		return parsed
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			slog.Warn("Invalid duration value in environment variables", "env", key, "value", value)
+			return fallback
+		}
+		return parsed
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			slog.Warn("Invalid integer value in environment variables", "env", key, "value", value)
+			return fallback
+		}
+		return parsed
+	}
+	return fallback
+}
+
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// searchOptionDefaults reads the search options, so the test command resolves like the server.
+func searchOptionDefaults() (allowNoBang, allowMultiBang bool, ignoreChar string) {
+	return getEnvBool("BANGS_ALLOW_NO_BANG", true), getEnvBool("BANGS_ALLOW_MULTI_BANG", false), getEnv("BANGS_IGNORE_CHAR", ".")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+// reloadFailed stands in for the error of a failed reload, which only the log shows.
+const reloadFailed = "last reload failed, see the server log"
+
+// registerHealth adds the health check and build info endpoints; /readyz fails once ctx is done.
+func registerHealth(ctx context.Context, router *http.ServeMux) {
+	router.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	router.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := bangs.CurrentStatus()
+		switch {
+		case ctx.Err() != nil:
+			http.Error(w, "not ready: shutting down", http.StatusServiceUnavailable)
+		case status.Generation == 0:
+			http.Error(w, "not ready: no registry loaded", http.StatusServiceUnavailable)
+		case status.LastError != "":
+			http.Error(w, "not ready: "+reloadFailed, http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+
+	router.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		status := bangs.CurrentStatus()
+		if status.LastError != "" {
+			status.LastError = reloadFailed
+		}
+		response := struct {
+			Version  string       `json:"version"`
+			Go       string       `json:"go"`
+			Registry bangs.Status `json:"registry"`
+		}{
+			Version:  version,
+			Go:       runtime.Version(),
+			Registry: status,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
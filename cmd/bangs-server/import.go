@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dikkadev/bangs/pkg/importer"
+
+	flag "github.com/spf13/pflag"
+)
+
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s import [flags] SOURCE...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Import search engines from Netscape bookmark HTML files, Firefox's search.json.mozlz4\nor OpenSearch description documents (file or URL) into a bangs file.\n\n")
+		flags.PrintDefaults()
+	}
+
+	var bangsFile string
+	flags.StringVarP(&bangsFile, "bangs", "b", os.Getenv("BANGS_BANGFILE"), "Path to the yaml file to merge the imported bangs into")
+
+	var format string
+	flags.StringVarP(&format, "format", "f", "", "Import format (netscape, firefox, opensearch); detected from the source if empty")
+
+	var bang string
+	flags.StringVar(&bang, "bang", "", "Bang to use for a single OpenSearch document (derived from its name if empty)")
+
+	var category string
+	flags.StringVarP(&category, "category", "c", "", "Category to set on imported bangs that have none")
+
+	var dryRun bool
+	flags.BoolVarP(&dryRun, "dry-run", "n", false, "Only print what would be imported")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if bangsFile == "" && !dryRun {
+		fmt.Fprintln(os.Stderr, "No bangs file given")
+		flags.Usage()
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "No import source given")
+		flags.Usage()
+		return 2
+	}
+
+	formats := make([]importer.Format, flags.NArg())
+	openSearch := 0
+	for i, source := range flags.Args() {
+		formats[i] = importer.Format(format)
+		if formats[i] == "" {
+			formats[i], err = importer.DetectFormat(source)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v, use --format\n", err)
+				return 1
+			}
+		}
+		if formats[i] == importer.FormatOpenSearch {
+			openSearch++
+		}
+	}
+	if bang != "" && openSearch > 1 {
+		fmt.Fprintln(os.Stderr, "--bang only works with a single OpenSearch source, import the others separately")
+		return 2
+	}
+
+	var imported []importer.Bang
+	for i, source := range flags.Args() {
+		bangs, err := importer.Read(source, formats[i], bang)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error importing '%s': %v\n", source, err)
+			return 1
+		}
+		imported = append(imported, bangs...)
+	}
+
+	for i := range imported {
+		if imported[i].Entry.Category == "" {
+			imported[i].Entry.Category = category
+		}
+	}
+
+	if dryRun {
+		for _, b := range imported {
+			fmt.Printf("%s: %s\n", b.Name, b.Entry)
+		}
+		return 0
+	}
+
+	added, skipped, err := importer.Merge(bangsFile, imported)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging into '%s': %v\n", bangsFile, err)
+		return 1
+	}
+	for _, b := range added {
+		fmt.Printf("added   %s (!%s)\n", b.Name, b.Entry.Bang)
+	}
+	for _, s := range skipped {
+		fmt.Printf("skipped %s (!%s): %s\n", s.Bang.Name, s.Bang.Entry.Bang, s.Reason)
+	}
+	fmt.Printf("Imported %d of %d bangs into %s\n", len(added), len(imported), bangsFile)
+	return 0
+}
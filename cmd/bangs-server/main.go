@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"github.com/dikkadev/bangs/internal/server"
 	"github.com/dikkadev/bangs/internal/watcher"
 	"github.com/dikkadev/bangs/pkg/bangs"
+	"github.com/dikkadev/bangs/pkg/middleware"
 	"github.com/dikkadev/bangs/web"
 	"io"
 	"io/fs"
@@ -11,10 +13,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dikkadev/prettyslog"
 	flag "github.com/spf13/pflag"
 )
 
@@ -23,40 +24,70 @@ import (
 
 var version = "dev"
 
-func main() {
-	getEnv := func(key, fallback string) string {
-		if value, exists := os.LookupEnv(key); exists {
-			return value
-		}
-		return fallback
-	}
+// defaultPasswordLimit bounds the password checks per client without --rate-limit-api.
+const defaultPasswordLimit = "10/m"
 
-	getEnvBool := func(key string, fallback bool) bool {
-		if value, exists := os.LookupEnv(key); exists {
-			parsed, err := strconv.ParseBool(value)
-			if err != nil {
-				slog.Warn("Invalid boolean value in environment variables", "env", key, "value", value)
-				return fallback
-			}
-			return parsed
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "test":
+			os.Exit(runTest(os.Args[2:]))
 		}
-		return fallback
 	}
 
 	bangsFileDefault := getEnv("BANGS_BANGFILE", "")
+	formatDefault := getEnv("BANGS_FORMAT", "")
 	debugLogsDefault := getEnvBool("BANGS_VERBOSE", false)
+	logModeDefault := getEnv("BANGS_LOG_MODE", "full")
+	logFormatDefault := getEnv("BANGS_LOG_FORMAT", "text")
 	portDefault := getEnv("BANGS_PORT", "8080")
 	watchBangFileDefault := getEnvBool("BANGS_WATCH", false)
-	allowNoBangDefault := getEnvBool("BANGS_ALLOW_NO_BANG", true)
-	allowMultiBangDefault := getEnvBool("BANGS_ALLOW_MULTI_BANG", false)
-	ignoreCharDefault := getEnv("BANGS_IGNORE_CHAR", ".")
+	allowNoBangDefault, allowMultiBangDefault, ignoreCharDefault := searchOptionDefaults()
+	adminTokenDefault := getEnv("BANGS_ADMIN_TOKEN", "")
+	drainTimeoutDefault := getEnvDuration("BANGS_DRAIN_TIMEOUT", server.DefaultDrainTimeout)
+	listenDefault := getEnv("BANGS_LISTEN", "")
+	tlsCertDefault := getEnv("BANGS_TLS_CERT", "")
+	tlsKeyDefault := getEnv("BANGS_TLS_KEY", "")
+	statsFileDefault := getEnv("BANGS_STATS_FILE", "")
+	statsRetentionDefault := getEnvInt("BANGS_STATS_RETENTION", 90)
+	historyFileDefault := getEnv("BANGS_HISTORY_FILE", "")
+	historyLimitDefault := getEnvInt("BANGS_HISTORY_LIMIT", 1000)
+	historyPrivateDefault := getEnvBool("BANGS_HISTORY_PRIVATE", false)
+	usersFileDefault := getEnv("BANGS_USERS", "")
+	userTokensDefault := getEnvList("BANGS_USER_TOKENS")
+	overlaysDirDefault := getEnv("BANGS_OVERLAYS", "")
+	sessionKeyFileDefault := getEnv("BANGS_SESSION_KEY_FILE", "")
+	profilesFileDefault := getEnv("BANGS_PROFILES", "")
+	rateLimitDefault := getEnv("BANGS_RATE_LIMIT", "")
+	rateLimitListDefault := getEnv("BANGS_RATE_LIMIT_LIST", "")
+	rateLimitAPIDefault := getEnv("BANGS_RATE_LIMIT_API", "")
+	trustedProxiesDefault := getEnvList("BANGS_TRUSTED_PROXIES")
+	securityHeadersDefault := getEnvBool("BANGS_SECURITY_HEADERS", true)
+	maxQueryLengthDefault := getEnvInt("BANGS_MAX_QUERY_LENGTH", 1024)
 
 	var bangsFile string
-	flag.StringVarP(&bangsFile, "bangs", "b", bangsFileDefault, "Path to the yaml file containing bang definitions")
+	flag.StringVarP(&bangsFile, "bangs", "b", bangsFileDefault, "Path to the yaml, json or toml file containing bang definitions")
+
+	var formatName string
+	flag.StringVar(&formatName, "format", formatDefault, "Format of the bangs file (yaml, json, toml); detected from the file extension if empty")
 
 	var debugLogs bool
 	flag.BoolVarP(&debugLogs, "verbose", "v", debugLogsDefault, "Show debug logs")
 
+	var logModeName string
+	flag.StringVar(&logModeName, "log-mode", logModeDefault, "How queries appear in the logs: full, redacted (bang, length and hash) or off (no request logs)")
+
+	var logFormatName string
+	flag.StringVar(&logFormatName, "log-format", logFormatDefault, "Log output format: text or json")
+
 	var showHelp bool
 	flag.BoolVarP(&showHelp, "help", "h", false, "Show this help")
 
@@ -75,6 +106,69 @@ func main() {
 	var ignoreChar string
 	flag.StringVarP(&ignoreChar, "ignore-char", "i", ignoreCharDefault, "Start with this character to ignore bangs (only uses first character of the string)")
 
+	var adminToken string
+	flag.StringVar(&adminToken, "admin-token", adminTokenDefault, "Bearer token for the API that edits the bangs file (disabled if empty)")
+
+	var listen string
+	flag.StringVarP(&listen, "listen", "l", listenDefault, "Address to listen on: host:port or unix:/path/to/socket; overrides --port")
+
+	var tlsCert string
+	flag.StringVar(&tlsCert, "tls-cert", tlsCertDefault, "Certificate file for HTTPS, reloaded when it changes")
+
+	var tlsKey string
+	flag.StringVar(&tlsKey, "tls-key", tlsKeyDefault, "Key file for HTTPS, reloaded when it changes")
+
+	var statsFile string
+	flag.StringVar(&statsFile, "stats-file", statsFileDefault, "File to keep bang usage statistics in (disabled if empty)")
+
+	var statsRetention int
+	flag.IntVar(&statsRetention, "stats-retention", statsRetentionDefault, "Days of bang usage to keep in the statistics")
+
+	var historyFile string
+	flag.StringVar(&historyFile, "history-file", historyFileDefault, "File to keep the search history in (disabled if empty)")
+
+	var historyLimit int
+	flag.IntVar(&historyLimit, "history-limit", historyLimitDefault, "Number of searches to keep in the history per user")
+
+	var historyPrivate bool
+	flag.BoolVar(&historyPrivate, "history-private", historyPrivateDefault, "Keep only the time and bang of searches in the history, never the query")
+
+	var usersFile string
+	flag.StringVar(&usersFile, "users", usersFileDefault, "htpasswd file (bcrypt only) with user accounts")
+
+	var userTokens []string
+	flag.StringSliceVar(&userTokens, "user-tokens", userTokensDefault, "Static user tokens as name=token, comma separated")
+
+	var overlaysDir string
+	flag.StringVar(&overlaysDir, "overlays", overlaysDirDefault, "Directory with a personal registry overlay per user, named <user>.yaml/.json/.toml")
+
+	var sessionKeyFile string
+	flag.StringVar(&sessionKeyFile, "session-key-file", sessionKeyFileDefault, "File with the key that signs login cookies, created if missing (random per start if empty)")
+
+	var profilesFile string
+	flag.StringVar(&profilesFile, "profiles", profilesFileDefault, "YAML file mapping hosts to registry profiles")
+
+	var rateLimit string
+	flag.StringVar(&rateLimit, "rate-limit", rateLimitDefault, "Searches per client, like 60/m (unlimited if empty)")
+
+	var rateLimitList string
+	flag.StringVar(&rateLimitList, "rate-limit-list", rateLimitListDefault, "Requests per client to the bang list, completion and stats, like 300/m (unlimited if empty)")
+
+	var rateLimitAPI string
+	flag.StringVar(&rateLimitAPI, "rate-limit-api", rateLimitAPIDefault, "Requests per client to the editing, history and login API, like 30/m (unlimited if empty)")
+
+	var trustedProxies []string
+	flag.StringSliceVar(&trustedProxies, "trusted-proxies", trustedProxiesDefault, "IP addresses or CIDR ranges of reverse proxies whose X-Forwarded-For is used to tell clients apart")
+
+	var securityHeaders bool
+	flag.BoolVar(&securityHeaders, "security-headers", securityHeadersDefault, "Send Content-Security-Policy, X-Frame-Options and Referrer-Policy headers")
+
+	var maxQueryLength int
+	flag.IntVar(&maxQueryLength, "max-query-length", maxQueryLengthDefault, "Longest query in bytes that is resolved (0 for no limit)")
+
+	var drainTimeout time.Duration
+	flag.DurationVar(&drainTimeout, "drain-timeout", drainTimeoutDefault, "How long in-flight requests may take to finish on SIGINT or SIGTERM")
+
 	flag.Parse()
 
 	if showHelp {
@@ -83,11 +177,22 @@ func main() {
 		os.Exit(0)
 	}
 
-	logOptions := make([]prettyslog.Option, 0)
+	logMode, err := middleware.ParseLogMode(logModeName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logFormat, err := middleware.ParseLogFormat(logFormatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	middleware.SetLogging(logMode, logFormat)
+	logLevel := slog.LevelInfo
 	if debugLogs {
-		logOptions = append(logOptions, prettyslog.WithLevel(slog.LevelDebug))
+		logLevel = slog.LevelDebug
 	}
-	slog.SetDefault(slog.New(prettyslog.NewPrettyslogHandler("APP", logOptions...)))
+	slog.SetDefault(slog.New(middleware.LogHandler("APP", logLevel)))
 	slog.Info("Starting bangs", "version", version)
 	if debugLogs {
 		slog.Debug("Activated debug log entries")
@@ -99,7 +204,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := bangs.Load(bangsFile)
+	format, err := bangs.ParseFormat(formatName)
+	if err != nil {
+		slog.Error("Invalid bangs file format", "err", err)
+		os.Exit(1)
+	}
+
+	err = bangs.LoadFormat(bangsFile, format)
 	if err != nil {
 		slog.Error("Error loading bangs", "err", err)
 		return
@@ -107,15 +218,129 @@ func main() {
 
 	if watchBangFile {
 		go watcher.WatchFile(bangsFile, func() error {
-			return bangs.Load(bangsFile)
+			return bangs.LoadFormat(bangsFile, format)
 		})
 	}
 
+	ctx := server.SignalContext()
+
+	var usage *bangs.UsageStats
+	if statsFile != "" {
+		usage, err = bangs.OpenUsageStats(statsFile, statsRetention)
+		if err != nil {
+			slog.Error("Error opening usage statistics", "err", err)
+			os.Exit(1)
+		}
+		bangs.SetUsageStats(usage)
+		go usage.SaveEvery(ctx, time.Minute)
+	}
+
+	if historyFile != "" {
+		history, err := bangs.OpenHistory(historyFile, historyLimit, historyPrivate)
+		if err != nil {
+			slog.Error("Error opening search history", "err", err)
+			os.Exit(1)
+		}
+		bangs.SetHistory(history)
+	}
+
+	var profiles *bangs.Profiles
+	if profilesFile != "" {
+		profiles, err = bangs.LoadProfiles(profilesFile)
+		if err != nil {
+			slog.Error("Error loading profiles", "err", err)
+			os.Exit(1)
+		}
+		if watchBangFile {
+			for _, file := range profiles.Files() {
+				go watcher.WatchFile(file, func() error {
+					return profiles.Reload(file)
+				})
+			}
+		}
+	}
+
+	var users *bangs.Users
+	if usersFile != "" || len(userTokens) > 0 {
+		tokens, err := bangs.ReadUserTokens(userTokens)
+		if err != nil {
+			slog.Error("Invalid user tokens", "err", err)
+			os.Exit(1)
+		}
+		var sessionKey []byte
+		if sessionKeyFile != "" {
+			sessionKey, err = bangs.ReadSessionKey(sessionKeyFile)
+			if err != nil {
+				slog.Error("Error reading session key", "err", err)
+				os.Exit(1)
+			}
+		}
+		users, err = bangs.NewUsers(usersFile, tokens, overlaysDir, sessionKey)
+		if err != nil {
+			slog.Error("Error loading users", "err", err)
+			os.Exit(1)
+		}
+		if watchBangFile && usersFile != "" {
+			go watcher.WatchFile(usersFile, users.LoadPasswords)
+		}
+		if watchBangFile && overlaysDir != "" {
+			go watcher.WatchFile(overlaysDir, users.LoadOverlays)
+		}
+	}
+
+	proxies, err := middleware.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		slog.Error("Invalid trusted proxies", "err", err)
+		os.Exit(1)
+	}
+	limiter := func(name, spec string) *middleware.RateLimiter {
+		rate, err := middleware.ParseRate(spec)
+		if err != nil {
+			slog.Error("Invalid rate limit", "limit", name, "err", err)
+			os.Exit(1)
+		}
+		if rate.Count > 0 {
+			slog.Info("Rate limiting clients", "limit", name, "rate", rate)
+		}
+		return middleware.NewRateLimiter(name, rate, proxies)
+	}
+	searchLimit := limiter("search", rateLimit).Middleware
+	listLimit := limiter("list", rateLimitList).Middleware
+	apiLimit := limiter("api", rateLimitAPI).Middleware
+	if users != nil {
+		// Passwords are checked before any route, so they have their own limit
+		passwordLimit := rateLimitAPI
+		if passwordLimit == "" {
+			passwordLimit = defaultPasswordLimit
+		}
+		users.LimitPasswordChecks(limiter("password", passwordLimit))
+	}
+
 	mainRouter := http.NewServeMux()
+	registerHealth(ctx, mainRouter)
+	mainRouter.Handle("GET /metrics", middleware.DefaultRegistry)
 
 	bangHandler := bangs.Handler(allowNoBang, allowMultiBang, ignoreChar)
-
-	mainRouter.Handle("/bang/", http.StripPrefix("/bang", bangHandler))
+	searchHandler := searchLimit(middleware.LimitQuery(maxQueryLength)(bangHandler))
+
+	mainRouter.Handle("/bang/", http.StripPrefix("/bang", searchHandler))
+	mainRouter.Handle("GET /explain", searchHandler)
+	mainRouter.Handle("/bang/list", listLimit(http.StripPrefix("/bang", bangHandler)))
+	mainRouter.Handle("/api/", apiLimit(http.StripPrefix("/api", bangs.EditorHandler(bangsFile, format, adminToken))))
+	mainRouter.Handle("GET /api/stats", listLimit(bangs.StatsHandler()))
+	mainRouter.Handle("GET /api/complete", listLimit(bangs.CompleteHandler()))
+	if historyFile != "" && adminToken == "" && len(proxies) > 0 {
+		slog.Warn("The search history API needs --admin-token behind trusted proxies, only logged in users can reach it")
+	}
+	historyHandler := apiLimit(http.StripPrefix("/api", bangs.HistoryHandler(adminToken, len(proxies) > 0)))
+	mainRouter.Handle("/api/history", historyHandler)
+	mainRouter.Handle("/api/history/", historyHandler)
+	if users != nil {
+		usersHandler := apiLimit(http.StripPrefix("/api", users.Handler()))
+		mainRouter.Handle("POST /api/login", usersHandler)
+		mainRouter.Handle("POST /api/logout", usersHandler)
+		mainRouter.Handle("GET /api/user", usersHandler)
+	}
 
 	frontendFS, err := web.FrontendFS()
 	if err != nil {
@@ -127,7 +352,7 @@ func main() {
 
 	mainRouter.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Query().Get("q") != "" {
-			bangHandler.ServeHTTP(w, r)
+			searchHandler.ServeHTTP(w, r)
 			return
 		}
 
@@ -158,16 +383,47 @@ func main() {
 		http.ServeContent(w, r, "index.html", info.ModTime(), index.(io.ReadSeeker))
 	})
 
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mainRouter,
+	if listen == "" {
+		listen = ":" + port
+	}
+	var handler http.Handler = mainRouter
+	if users != nil {
+		handler = users.Middleware(handler)
+	}
+	if profiles != nil {
+		handler = profiles.Middleware(handler)
+	}
+	if securityHeaders {
+		handler = middleware.SecurityHeaders(handler)
+	}
+	handler = middleware.CreateStack(
+		middleware.AssignRequestID,
+		middleware.Recover,
+	)(handler)
+	srv := server.New(listen, handler)
+	if tlsCert != "" || tlsKey != "" {
+		err = server.EnableTLS(srv, tlsCert, tlsKey)
+		if err != nil {
+			slog.Error("Error setting up TLS", "err", err)
+			os.Exit(1)
+		}
 	}
 
-	slog.Info("Starting server on", "port", port)
+	listeners, err := server.Listeners(listen)
+	if err != nil {
+		slog.Error("Error listening", "addr", listen, "err", err)
+		os.Exit(1)
+	}
 
-	err = server.ListenAndServe()
+	err = server.Serve(ctx, srv, listeners, drainTimeout)
+	if usage != nil {
+		saveErr := usage.Save()
+		if saveErr != nil {
+			slog.Error("Error saving usage statistics", "err", saveErr)
+		}
+	}
 	if err != nil {
-		slog.Error("Error starting server", "err", err)
-		return
+		slog.Error("Error running server", "err", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+
+	flag "github.com/spf13/pflag"
+)
+
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s migrate [flags] [FILE]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Rewrite a bangs file to registry format version %d.\nPrints the result unless --write or --output is given.\n\n", bangs.LatestVersion)
+		flags.PrintDefaults()
+	}
+
+	var bangsFile string
+	flags.StringVarP(&bangsFile, "bangs", "b", os.Getenv("BANGS_BANGFILE"), "Path to the bangs file to migrate")
+
+	var formatName string
+	flags.StringVar(&formatName, "format", os.Getenv("BANGS_FORMAT"), "Format of the bangs file (yaml, json, toml); detected from the file extension if empty")
+
+	var write bool
+	flags.BoolVarP(&write, "write", "w", false, "Overwrite the bangs file in place")
+
+	var output string
+	flags.StringVarP(&output, "output", "o", "", "Write the migrated file to this path")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	format, err := bangs.ParseFormat(formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	if flags.NArg() == 1 {
+		bangsFile = flags.Arg(0)
+	}
+	if bangsFile == "" {
+		fmt.Fprintln(os.Stderr, "No bangs file given")
+		flags.Usage()
+		return 2
+	}
+	if write && output != "" {
+		fmt.Fprintln(os.Stderr, "--write and --output cannot be used together")
+		return 2
+	}
+	if format == "" {
+		format = bangs.FormatFromPath(bangsFile)
+	}
+
+	data, err := os.ReadFile(bangsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	migrated, err := bangs.Migrate(data, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", bangsFile, err)
+		return 1
+	}
+
+	if write {
+		output = bangsFile
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(migrated)
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(bangsFile); err == nil {
+		perm = info.Mode().Perm()
+	}
+	err = os.WriteFile(output, migrated, perm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %s to version %d: %s\n", bangsFile, bangs.LatestVersion, output)
+	return 0
+}
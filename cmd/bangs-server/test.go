@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+
+	flag "github.com/spf13/pflag"
+)
+
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s test [flags] [FILE...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Run the tests declared by the entries and aliases of bangs files.\nExits with status 1 if any test fails.\n\n")
+		flags.PrintDefaults()
+	}
+
+	var bangsFile string
+	flags.StringVarP(&bangsFile, "bangs", "b", os.Getenv("BANGS_BANGFILE"), "Path to the bangs file to test")
+
+	var formatName string
+	flags.StringVar(&formatName, "format", os.Getenv("BANGS_FORMAT"), "Format of the bangs file (yaml, json, toml); detected from the file extension if empty")
+
+	allowNoBangDefault, allowMultiBangDefault, ignoreCharDefault := searchOptionDefaults()
+
+	var allowNoBang bool
+	flags.BoolVarP(&allowNoBang, "allow-no-bang", "a", allowNoBangDefault, "Resolve input like a server started with --allow-no-bang")
+
+	var allowMultiBang bool
+	flags.BoolVarP(&allowMultiBang, "allow-multi-bang", "m", allowMultiBangDefault, "Resolve input like a server started with --allow-multi-bang")
+
+	var ignoreChar string
+	flags.StringVarP(&ignoreChar, "ignore-char", "i", ignoreCharDefault, "Resolve input like a server started with this --ignore-char")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if ignoreChar == "" {
+		fmt.Fprintln(os.Stderr, "The ignore character must not be empty")
+		return 2
+	}
+
+	format, err := bangs.ParseFormat(formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 && bangsFile != "" {
+		files = []string{bangsFile}
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No bangs file given")
+		flags.Usage()
+		return 2
+	}
+
+	bangs.SetOptions(allowNoBang, allowMultiBang, ignoreChar)
+
+	failed := false
+	for _, file := range files {
+		reg, err := bangs.ParseFile(file, format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		failures := reg.RunTests()
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "%s: %s", file, failure)
+		}
+		if len(failures) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %d of %d tests failed\n", file, len(failures), reg.NumTests())
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok (%d tests)\n", file, reg.NumTests())
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
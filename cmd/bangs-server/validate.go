@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+
+	flag "github.com/spf13/pflag"
+)
+
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s validate [flags] [FILE...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Load and validate bangs files without starting the server.\nExits with status 1 if any file has problems.\n\n")
+		flags.PrintDefaults()
+	}
+
+	var bangsFile string
+	flags.StringVarP(&bangsFile, "bangs", "b", os.Getenv("BANGS_BANGFILE"), "Path to the bangs file to validate")
+
+	var formatName string
+	flags.StringVar(&formatName, "format", os.Getenv("BANGS_FORMAT"), "Format of the bangs file (yaml, json, toml); detected from the file extension if empty")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	format, err := bangs.ParseFormat(formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 && bangsFile != "" {
+		files = []string{bangsFile}
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No bangs file given")
+		flags.Usage()
+		return 2
+	}
+
+	failed := false
+	for _, file := range files {
+		reg, err := bangs.ParseFile(file, format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		problems := reg.Validate()
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, problem)
+		}
+		if len(problems) > 0 {
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok (%d bangs, %d aliases)\n", file, len(reg.Entries.Entries), len(reg.Aliases))
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func runSchema(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s schema\n\nPrint the JSON Schema of the bangs file format.\n", os.Args[0])
+		return 2
+	}
+	_, err := os.Stdout.Write(bangs.Schema)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Listeners returns the sockets passed by systemd socket activation, or a listener on addr.
+func Listeners(addr string) ([]net.Listener, error) {
+	lns, err := ActivationListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(lns) > 0 {
+		return lns, nil
+	}
+	ln, err := Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{ln}, nil
+}
+
+// Listen listens on a TCP address like ":8080" or a Unix socket like "unix:/path/to/socket".
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("missing socket path in listen address '%s'", addr)
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if _, err := net.Dial("unix", path); err == nil {
+				return nil, fmt.Errorf("socket %s is in use", path)
+			}
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	return net.Listen("tcp", addr)
+}
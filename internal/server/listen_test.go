@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bangs.sock")
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Errorf("expected an error for a socket in use")
+	}
+
+	srv := New("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	go srv.Serve(ln)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	resp, err := client.Get("http://bangs/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("expected ok, got %q", body)
+	}
+	srv.Close()
+
+	// A socket file left behind without a server is replaced.
+	os.Remove(path)
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	ln, err = Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %v", err)
+	}
+	ln.Close()
+}
+
+func TestListen_TCP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:0", "0"} {
+		ln, err := Listen(addr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", addr, err)
+		}
+		if ln.Addr().Network() != "tcp" {
+			t.Errorf("%s: expected a tcp listener, got %s", addr, ln.Addr().Network())
+		}
+		ln.Close()
+	}
+}
+
+func TestActivationListeners(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	lns, err := ActivationListeners()
+	if err != nil || len(lns) != 0 {
+		t.Errorf("expected sockets meant for another process to be ignored, got %v, %v", lns, err)
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "none")
+	if _, err := ActivationListeners(); err == nil {
+		t.Errorf("expected an error for an invalid LISTEN_FDS")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := Notify("READY=1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("expected READY=1, got %q, %v", buf[:n], err)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("expected no error without NOTIFY_SOCKET, got %v", err)
+	}
+}
+
+// writeCert writes a self-signed certificate for name to certFile and keyFile.
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnableTLS_Reloads(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+
+	defer func(interval time.Duration) { certCheckInterval = interval }(certCheckInterval)
+	certCheckInterval = 20 * time.Millisecond
+	srv := New("", http.NotFoundHandler())
+	if err := EnableTLS(srv, certFile, keyFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	commonName := func() string {
+		cert, err := srv.TLSConfig.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+	if name := commonName(); name != "first" {
+		t.Fatalf("expected the first certificate, got %s", name)
+	}
+
+	writeCert(t, certFile, keyFile, "second")
+	deadline := time.Now().Add(3 * time.Second)
+	for commonName() != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the certificate to be reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := EnableTLS(New("", nil), certFile, ""); err == nil {
+		t.Errorf("expected an error without a key file")
+	}
+	if err := EnableTLS(New("", nil), keyFile, certFile); err == nil {
+		t.Errorf("expected an error for swapped files")
+	}
+}
+
+func TestCertReloader_SymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		os.Mkdir(filepath.Join(dir, version), 0o700)
+		writeCert(t, filepath.Join(dir, version, "cert.pem"), filepath.Join(dir, version, "key.pem"), version)
+	}
+	// Like a Kubernetes secret: the files are symlinks through a "current"
+	// symlink that is swapped to a new directory on renewal.
+	if err := os.Symlink("v1", filepath.Join(dir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"cert.pem", "key.pem"} {
+		os.Symlink(filepath.Join("current", file), filepath.Join(dir, file))
+	}
+
+	r := &certReloader{certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem")}
+	if err := r.load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.changed() {
+		t.Errorf("expected no change right after loading")
+	}
+
+	os.Symlink("v2", filepath.Join(dir, "next"))
+	if err := os.Rename(filepath.Join(dir, "next"), filepath.Join(dir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if !r.changed() {
+		t.Fatalf("expected the swapped symlink to count as a change")
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, _ := r.getCertificate(nil)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || parsed.Subject.CommonName != "v2" {
+		t.Errorf("expected the v2 certificate to be served, got %v, %v", parsed, err)
+	}
+
+	// A renewal caught halfway, with only the certificate replaced, fails
+	// and is tried again until the key follows.
+	writeCert(t, filepath.Join(dir, "v3-cert.pem"), filepath.Join(dir, "v3-key.pem"), "v3")
+	os.Rename(filepath.Join(dir, "v3-cert.pem"), filepath.Join(dir, "v2", "cert.pem"))
+	if !r.changed() || r.load() == nil {
+		t.Fatalf("expected the half-replaced pair to fail loading")
+	}
+	if !r.changed() {
+		t.Errorf("expected the failed pair to still count as a change")
+	}
+	os.Rename(filepath.Join(dir, "v3-key.pem"), filepath.Join(dir, "v2", "key.pem"))
+	if err := r.load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.changed() {
+		t.Errorf("expected no change after loading the complete pair")
+	}
+
+	os.Remove(filepath.Join(dir, "current"))
+	if r.changed() {
+		t.Errorf("expected missing files not to count as a change")
+	}
+}
@@ -0,0 +1,85 @@
+// Package server runs HTTP servers with timeouts, header limits and a graceful shutdown.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Limits applied to every server.
+const (
+	ReadHeaderTimeout = 10 * time.Second
+	ReadTimeout       = 30 * time.Second
+	WriteTimeout      = 60 * time.Second
+	IdleTimeout       = 120 * time.Second
+	MaxHeaderBytes    = 64 << 10
+)
+
+// DefaultDrainTimeout is how long in-flight requests may take after a shutdown signal.
+const DefaultDrainTimeout = 15 * time.Second
+
+// New returns a server for handler on addr with the limits above.
+func New(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
+		MaxHeaderBytes:    MaxHeaderBytes,
+	}
+}
+
+// Serve serves on every listener until ctx is done, then drains in-flight requests for up to drain.
+func Serve(ctx context.Context, srv *http.Server, lns []net.Listener, drain time.Duration) error {
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		slog.Info("Listening", "addr", ln.Addr().String(), "network", ln.Addr().Network(), "tls", srv.TLSConfig != nil)
+		go func() {
+			if srv.TLSConfig != nil {
+				errc <- srv.ServeTLS(ln, "", "")
+				return
+			}
+			errc <- srv.Serve(ln)
+		}()
+	}
+	notify("READY=1")
+
+	select {
+	case err := <-errc:
+		srv.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	notify("STOPPING=1")
+	slog.Info("Shutting down server, draining connections", "timeout", drain)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		srv.Close()
+		return fmt.Errorf("draining connections: %w", err)
+	}
+	for range lns {
+		err = <-errc
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+func notify(state string) {
+	err := Notify(state)
+	if err != nil {
+		slog.Warn("Error notifying systemd", "state", state, "err", err)
+	}
+}
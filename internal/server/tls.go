@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for changes.
+var certCheckInterval = time.Minute
+
+// certReloader serves a cert/key pair and reloads it when the files change.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	// files are what the paths, followed through symlinks, pointed to at the last load.
+	files []os.FileInfo
+}
+
+func (r *certReloader) stat() ([]os.FileInfo, error) {
+	files := make([]os.FileInfo, 0, 2)
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+func (r *certReloader) load() error {
+	files, err := r.stat()
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	// Only a pair that loaded is recorded, so a failed one is tried again.
+	r.files = files
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether a path leads to another or rewritten file; missing files are no change.
+func (r *certReloader) changed() bool {
+	files, err := r.stat()
+	if err != nil {
+		return false
+	}
+	for i, info := range files {
+		last := r.files[i]
+		if !os.SameFile(info, last) || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if !r.changed() {
+			continue
+		}
+		err := r.load()
+		if err != nil {
+			slog.Error("Error reloading TLS certificate", "err", err)
+			continue
+		}
+		slog.Info("Reloaded TLS certificate", "cert", r.certFile)
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// EnableTLS makes srv serve HTTPS with certFile and keyFile, reloaded when they change.
+func EnableTLS(srv *http.Server, certFile, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := r.load()
+	if err != nil {
+		return err
+	}
+	go r.watch(certCheckInterval)
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	return nil
+}
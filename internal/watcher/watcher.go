@@ -3,11 +3,13 @@ package watcher
 import (
 	"log/slog"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// WatchFile runs action whenever file changes, watching its directory so renames over it are seen.
 func WatchFile(file string, action func() error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -16,7 +18,13 @@ func WatchFile(file string, action func() error) {
 	}
 	defer watcher.Close()
 
-	err = watcher.Add(file)
+	watched := file
+	info, err := os.Stat(file)
+	isDir := err == nil && info.IsDir()
+	if !isDir {
+		watched = filepath.Dir(file)
+	}
+	err = watcher.Add(watched)
 	if err != nil {
 		slog.Error("Error adding file to watcher", "err", err)
 		return
@@ -29,21 +37,17 @@ func WatchFile(file string, action func() error) {
 			if !ok {
 				return
 			}
+			if !isDir && filepath.Clean(event.Name) != filepath.Clean(file) {
+				continue
+			}
 			slog.Debug("Watcher event", "op", event.Op, "file", event.Name)
 
 			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Rename == fsnotify.Rename {
-				// Delay before re-adding to handle rename issues (apprently vim renames the file and overwrites somehing? not sure, but this seems to work)
+				// Some editors rename the file away and write a new one, give them a moment
 				if event.Op&fsnotify.Rename == fsnotify.Rename {
 					time.Sleep(100 * time.Millisecond)
-
-					// Ensure file exists before re-adding to watcher
-					if _, err := os.Stat(file); err == nil {
-						err = watcher.Add(file)
-						if err != nil {
-							slog.Error("Error re-adding file to watcher", "err", err)
-						}
-					} else {
-						slog.Error("File does not exist after rename; cannot re-add", "file", file)
+					if _, err := os.Stat(file); err != nil {
+						continue
 					}
 				}
 
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/dikkadev/bangs/internal/server"
 	"github.com/dikkadev/bangs/internal/watcher"
 	"github.com/dikkadev/bangs/pkg/bangs"
 	"log/slog"
+	gohttp "net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dikkadev/prettyslog"
+	"github.com/gin-gonic/gin"
 	mcp "github.com/metoro-io/mcp-golang"
 	"github.com/metoro-io/mcp-golang/transport/http"
 	"github.com/metoro-io/mcp-golang/transport/stdio"
@@ -30,11 +36,37 @@ type MultiBangResult struct {
 }
 
 type BangInfo struct {
-	Name        string `json:"name"`
-	Bang        string `json:"bang"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
-	URL         string `json:"url"`
+	Name        string   `json:"name"`
+	Bang        string   `json:"bang"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	URL         string   `json:"url"`
+	Tags        []string `json:"tags,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	Examples    []string `json:"examples,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+	Template    string   `json:"template,omitempty"`
+}
+
+func newBangInfo(name string, entry bangs.Entry) BangInfo {
+	return BangInfo{
+		Name:        name,
+		Bang:        entry.Bang,
+		Description: entry.Description,
+		Category:    entry.Category,
+		URL:         string(entry.URL),
+		Tags:        entry.Tags,
+		Icon:        entry.Icon,
+		Examples:    entry.Examples,
+		Aliases:     entry.Aliases,
+		Hidden:      entry.Hidden,
+		Deprecated:  entry.Deprecated,
+		Replacement: entry.Replacement,
+		Template:    entry.Template,
+	}
 }
 
 func main() {
@@ -57,16 +89,36 @@ func main() {
 		return fallback
 	}
 
+	getEnvDuration := func(key string, fallback time.Duration) time.Duration {
+		if value, exists := os.LookupEnv(key); exists {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				slog.Warn("Invalid duration value in environment variables", "env", key, "value", value)
+				return fallback
+			}
+			return parsed
+		}
+		return fallback
+	}
+
 	// Environment variables
 	bangsFileDefault := getEnv("BANGS_BANGFILE", "")
+	formatDefault := getEnv("BANGS_FORMAT", "")
 	debugLogsDefault := getEnvBool("BANGS_VERBOSE", false)
 	watchBangFileDefault := getEnvBool("BANGS_WATCH", false)
 	httpModeDefault := getEnvBool("BANGS_MCP_HTTP", false)
 	portDefault := getEnv("BANGS_MCP_PORT", "8081")
+	drainTimeoutDefault := getEnvDuration("BANGS_DRAIN_TIMEOUT", server.DefaultDrainTimeout)
+	listenDefault := getEnv("BANGS_MCP_LISTEN", "")
+	tlsCertDefault := getEnv("BANGS_MCP_TLS_CERT", "")
+	tlsKeyDefault := getEnv("BANGS_MCP_TLS_KEY", "")
 
 	// Command line flags
 	var bangsFile string
-	flag.StringVarP(&bangsFile, "bangs", "b", bangsFileDefault, "Path to the yaml file containing bang definitions")
+	flag.StringVarP(&bangsFile, "bangs", "b", bangsFileDefault, "Path to the yaml, json or toml file containing bang definitions")
+
+	var formatName string
+	flag.StringVar(&formatName, "format", formatDefault, "Format of the bangs file (yaml, json, toml); detected from the file extension if empty")
 
 	var debugLogs bool
 	flag.BoolVarP(&debugLogs, "verbose", "v", debugLogsDefault, "Show debug logs")
@@ -83,6 +135,18 @@ func main() {
 	var port string
 	flag.StringVarP(&port, "port", "p", portDefault, "Port to listen on (HTTP mode only)")
 
+	var listen string
+	flag.StringVarP(&listen, "listen", "l", listenDefault, "Address to listen on: host:port or unix:/path/to/socket; overrides --port (HTTP mode only)")
+
+	var tlsCert string
+	flag.StringVar(&tlsCert, "tls-cert", tlsCertDefault, "Certificate file for HTTPS, reloaded when it changes (HTTP mode only)")
+
+	var tlsKey string
+	flag.StringVar(&tlsKey, "tls-key", tlsKeyDefault, "Key file for HTTPS, reloaded when it changes (HTTP mode only)")
+
+	var drainTimeout time.Duration
+	flag.DurationVar(&drainTimeout, "drain-timeout", drainTimeoutDefault, "How long in-flight requests may take to finish on SIGINT or SIGTERM (HTTP mode only)")
+
 	flag.Parse()
 
 	if showHelp {
@@ -119,8 +183,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	format, err := bangs.ParseFormat(formatName)
+	if err != nil {
+		slog.Error("Invalid bangs file format", "err", err)
+		os.Exit(1)
+	}
+
 	// Load bangs registry
-	err := bangs.Load(bangsFile)
+	err = bangs.LoadFormat(bangsFile, format)
 	if err != nil {
 		slog.Error("Error loading bangs", "err", err)
 		os.Exit(1)
@@ -130,16 +200,31 @@ func main() {
 	if watchBangFile {
 		go watcher.WatchFile(bangsFile, func() error {
 			slog.Info("Reloading bangs configuration")
-			return bangs.Load(bangsFile)
+			return bangs.LoadFormat(bangsFile, format)
 		})
 	}
 
-	// Create MCP server
-	var server *mcp.Server
+	// Create MCP server; in HTTP mode it is served like the web server
+	var mcpServer *mcp.Server
+	var httpServer *gohttp.Server
 	if httpMode {
-		slog.Info("Starting MCP server in HTTP mode", "port", port)
-		httpTransport := http.NewHTTPTransport("/mcp").WithAddr(":" + port)
-		server = mcp.NewServer(
+		if listen == "" {
+			listen = ":" + port
+		}
+		slog.Info("Starting MCP server in HTTP mode", "listen", listen)
+		httpTransport := http.NewGinTransport()
+		gin.SetMode(gin.ReleaseMode)
+		router := gin.New()
+		router.POST("/mcp", httpTransport.Handler())
+		httpServer = server.New(listen, router)
+		if tlsCert != "" || tlsKey != "" {
+			err = server.EnableTLS(httpServer, tlsCert, tlsKey)
+			if err != nil {
+				slog.Error("Error setting up TLS", "err", err)
+				os.Exit(1)
+			}
+		}
+		mcpServer = mcp.NewServer(
 			httpTransport,
 			mcp.WithName("bangs-mcp-server"),
 			mcp.WithVersion(version),
@@ -147,7 +232,7 @@ func main() {
 		)
 	} else {
 		slog.Info("Starting MCP server in stdio mode")
-		server = mcp.NewServer(
+		mcpServer = mcp.NewServer(
 			stdio.NewStdioServerTransport(),
 			mcp.WithName("bangs-mcp-server"),
 			mcp.WithVersion(version),
@@ -156,28 +241,45 @@ func main() {
 	}
 
 	// Register tools
-	err = registerTools(server)
+	err = registerTools(mcpServer)
 	if err != nil {
 		slog.Error("Error registering tools", "err", err)
 		os.Exit(1)
 	}
 
 	// Register resources
-	err = registerResources(server)
+	err = registerResources(mcpServer)
 	if err != nil {
 		slog.Error("Error registering resources", "err", err)
 		os.Exit(1)
 	}
 
 	// Start server
-	err = server.Serve()
+	err = mcpServer.Serve()
 	if err != nil {
 		slog.Error("Error starting MCP server", "err", err)
 		os.Exit(1)
 	}
 
-	// Keep running
-	select {}
+	ctx := server.SignalContext()
+	if httpServer != nil {
+		listeners, err := server.Listeners(httpServer.Addr)
+		if err != nil {
+			slog.Error("Error listening", "addr", httpServer.Addr, "err", err)
+			os.Exit(1)
+		}
+		err = server.Serve(ctx, httpServer, listeners, drainTimeout)
+		if err != nil {
+			slog.Error("Error running MCP server", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Keep running until interrupted
+	server.Notify("READY=1")
+	<-ctx.Done()
+	slog.Info("Stopping MCP server")
 }
 
 // Tool argument types
@@ -204,7 +306,7 @@ func registerTools(server *mcp.Server) error {
 		allBangs := bangs.All()
 		var targetEntry *bangs.Entry
 		for _, entry := range allBangs.Entries {
-			if entry.Bang == arguments.Bang {
+			if entry.Bang == arguments.Bang || slices.Contains(entry.Aliases, arguments.Bang) {
 				targetEntry = &entry
 				break
 			}
@@ -243,7 +345,7 @@ func registerTools(server *mcp.Server) error {
 		for _, bangName := range arguments.Bangs {
 			var targetEntry *bangs.Entry
 			for _, entry := range allBangs.Entries {
-				if entry.Bang == bangName {
+				if entry.Bang == bangName || slices.Contains(entry.Aliases, bangName) {
 					targetEntry = &entry
 					break
 				}
@@ -296,18 +398,10 @@ func registerTools(server *mcp.Server) error {
 	err = server.RegisterTool("get_bangs_by_category", "Get all bangs in a specific category", func(arguments GetBangsByCategoryArgs) (*mcp.ToolResponse, error) {
 		slog.Debug("Getting bangs by category", "category", arguments.Category)
 
-		allBangs := bangs.All()
 		var categoryBangs []BangInfo
-
-		for name, entry := range allBangs.Entries {
+		for _, entry := range bangs.ListedEntries() {
 			if entry.Category == arguments.Category {
-				categoryBangs = append(categoryBangs, BangInfo{
-					Name:        name,
-					Bang:        entry.Bang,
-					Description: entry.Description,
-					Category:    entry.Category,
-					URL:         string(entry.URL),
-				})
+				categoryBangs = append(categoryBangs, newBangInfo(entry.Name, entry.Entry))
 			}
 		}
 
@@ -333,21 +427,25 @@ func registerTools(server *mcp.Server) error {
 func registerResources(server *mcp.Server) error {
 	// Registry resource
 	err := server.RegisterResource("bangs://registry", "bangs_registry", "Complete bangs registry", "application/json", func() (*mcp.ResourceResponse, error) {
-		allBangs := bangs.All()
-
-		// Convert to a more structured format
-		registry := make(map[string]BangInfo)
-		for name, entry := range allBangs.Entries {
-			registry[name] = BangInfo{
-				Name:        name,
-				Bang:        entry.Bang,
-				Description: entry.Description,
-				Category:    entry.Category,
-				URL:         string(entry.URL),
-			}
+		// Convert to a more structured format; entries holds the same bangs in declaration order
+		registry := struct {
+			Bangs   map[string]BangInfo `json:"bangs"`
+			Entries []BangInfo          `json:"entries"`
+		}{
+			Bangs:   make(map[string]BangInfo),
+			Entries: make([]BangInfo, 0),
+		}
+		for _, entry := range bangs.ListedEntries() {
+			info := newBangInfo(entry.Name, entry.Entry)
+			registry.Bangs[entry.Name] = info
+			registry.Entries = append(registry.Entries, info)
 		}
 
-		return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource("bangs://registry", fmt.Sprintf("%+v", registry), "application/json")), nil
+		asJSON, err := json.Marshal(registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode registry: %v", err)
+		}
+		return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource("bangs://registry", string(asJSON), "application/json")), nil
 	})
 	if err != nil {
 		return fmt.Errorf("failed to register registry resource: %v", err)
@@ -355,22 +453,21 @@ func registerResources(server *mcp.Server) error {
 
 	// Categories resource
 	err = server.RegisterResource("bangs://categories", "bangs_categories", "Available bang categories", "application/json", func() (*mcp.ResourceResponse, error) {
-		allBangs := bangs.All()
-
-		// Collect unique categories
+		// Collect unique categories in order of first appearance
 		categories := make(map[string]bool)
-		for _, entry := range allBangs.Entries {
-			if entry.Category != "" {
+		categoryList := make([]string, 0)
+		for _, entry := range bangs.ListedEntries() {
+			if entry.Category != "" && !categories[entry.Category] {
 				categories[entry.Category] = true
+				categoryList = append(categoryList, entry.Category)
 			}
 		}
 
-		var categoryList []string
-		for category := range categories {
-			categoryList = append(categoryList, category)
+		asJSON, err := json.Marshal(categoryList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode categories: %v", err)
 		}
-
-		return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource("bangs://categories", fmt.Sprintf("%+v", categoryList), "application/json")), nil
+		return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource("bangs://categories", string(asJSON), "application/json")), nil
 	})
 	if err != nil {
 		return fmt.Errorf("failed to register categories resource: %v", err)
@@ -0,0 +1,228 @@
+package bangs
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
+)
+
+type entryRequest struct {
+	Name string `json:"name"`
+	Entry
+}
+
+type aliasRequest struct {
+	Alias  string `json:"alias"`
+	Target string `json:"target"`
+}
+
+type editor struct {
+	mu     sync.Mutex
+	path   string
+	format Format
+	token  string
+}
+
+// EditorHandler serves the API to edit the entries and aliases of the registry file at path, authenticated by token.
+func EditorHandler(path string, format Format, token string) http.Handler {
+	if format == "" {
+		format = FormatFromPath(path)
+	}
+	e := &editor{path: path, format: format, token: token}
+
+	router := http.NewServeMux()
+	router.HandleFunc("POST /entries", e.createEntry)
+	router.HandleFunc("PUT /entries/{name}", e.updateEntry)
+	router.HandleFunc("DELETE /entries/{name}", e.deleteEntry)
+	router.HandleFunc("POST /aliases", e.createAlias)
+	router.HandleFunc("PUT /aliases/{alias}", e.updateAlias)
+	router.HandleFunc("DELETE /aliases/{alias}", e.deleteAlias)
+
+	logger := middleware.NewLogger("API")
+	stack := middleware.CreateStack(
+		middleware.Logger(logger, "api"),
+		e.authenticate,
+	)
+
+	return stack(router)
+}
+
+func (e *editor) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e.token == "" {
+			http.Error(w, "Editing API is disabled, set an admin token to enable it", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(e.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bangs"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if e.format != FormatYAML {
+			http.Error(w, fmt.Sprintf("Editing is only supported for yaml registry files, not %s", e.format), http.StatusNotImplemented)
+			return
+		}
+		if profile := RequestProfile(r); profile != "" {
+			http.Error(w, fmt.Sprintf("Editing is not supported for profile '%s', only for the main registry", profile), http.StatusNotImplemented)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *editor) apply(w http.ResponseWriter, status int, response any, edit func(d *registryDocument) error) {
+	e.mu.Lock()
+	err := editFile(e.path, edit)
+	e.mu.Unlock()
+
+	if err != nil {
+		var (
+			notFound EditNotFoundError
+			conflict EditConflictError
+			invalid  EditInvalidError
+		)
+		switch {
+		case errors.As(err, &notFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.As(err, &conflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &invalid):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			slog.Error("Error editing registry", "file", e.path, "err", err)
+			http.Error(w, fmt.Sprintf("Error editing registry: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, response any) {
+	asJSON, err := json.Marshal(response)
+	if err != nil {
+		slog.Error("Error converting response to json", "err", err)
+		http.Error(w, fmt.Sprintf("Internal JSON error -.-\n%v\n", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(asJSON)
+	if err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (req *entryRequest) normalize() {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Bang = strings.TrimSpace(req.Bang)
+}
+
+func (e *editor) createEntry(w http.ResponseWriter, r *http.Request) {
+	var req entryRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.normalize()
+	if req.Name == "" {
+		http.Error(w, "Entry name is required", http.StatusBadRequest)
+		return
+	}
+	e.apply(w, http.StatusCreated, req, func(d *registryDocument) error {
+		return d.createEntry(req.Name, req.Entry)
+	})
+}
+
+// updateEntry replaces the fields of an entry, renaming it if the body has another name.
+func (e *editor) updateEntry(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req entryRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.normalize()
+	if req.Name == "" {
+		req.Name = name
+	}
+	e.apply(w, http.StatusOK, req, func(d *registryDocument) error {
+		err := d.updateEntry(name, req.Entry)
+		if err != nil {
+			return err
+		}
+		return d.renameEntry(name, req.Name)
+	})
+}
+
+func (e *editor) deleteEntry(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	e.apply(w, http.StatusNoContent, nil, func(d *registryDocument) error {
+		return d.deleteEntry(name)
+	})
+}
+
+func (e *editor) createAlias(w http.ResponseWriter, r *http.Request) {
+	var req aliasRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Alias = strings.TrimSpace(req.Alias)
+	if req.Alias == "" || req.Target == "" {
+		http.Error(w, "Alias and target are required", http.StatusBadRequest)
+		return
+	}
+	e.apply(w, http.StatusCreated, req, func(d *registryDocument) error {
+		return d.setAlias(req.Alias, req.Target, true)
+	})
+}
+
+// updateAlias changes the target of an alias, renaming it if the body has another alias.
+func (e *editor) updateAlias(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+	var req aliasRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Alias = strings.TrimSpace(req.Alias)
+	if req.Alias == "" {
+		req.Alias = alias
+	}
+	e.apply(w, http.StatusOK, req, func(d *registryDocument) error {
+		if req.Target != "" {
+			err := d.setAlias(alias, req.Target, false)
+			if err != nil {
+				return err
+			}
+		}
+		return d.renameAlias(alias, req.Alias)
+	})
+}
+
+func (e *editor) deleteAlias(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+	e.apply(w, http.StatusNoContent, nil, func(d *registryDocument) error {
+		return d.deleteAlias(alias)
+	})
+}
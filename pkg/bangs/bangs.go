@@ -1,11 +1,16 @@
 package bangs
 
 import (
+	"context"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
 )
 
 type QueryURL string
@@ -54,6 +59,23 @@ type Entry struct {
 	Description string   `yaml:"description" json:"description"`
 	URL         QueryURL `yaml:"url" json:"url"`
 	Category    string   `yaml:"category,omitempty" json:"category,omitempty"`
+	Tags        []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Icon defaults to the favicon of the entry's site.
+	Icon     string   `yaml:"icon,omitempty" json:"icon,omitempty"`
+	Examples []string `yaml:"examples,omitempty" json:"examples,omitempty"`
+	// Aliases are extra bangs that resolve to this entry.
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	// Hidden entries work but are left out of listings.
+	Hidden bool `yaml:"hidden,omitempty" json:"hidden,omitempty"`
+	// Deprecated entries show a notice, pointing to Replacement if set, before redirecting.
+	Deprecated  bool   `yaml:"deprecated,omitempty" json:"deprecated,omitempty"`
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	// Extends names the entry or template the unset fields are taken from.
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
+	// Template names the matrix entry this entry was generated from.
+	Template string `yaml:"-" json:"template,omitempty"`
+	// Tests are example searches checked by RunTests.
+	Tests []TestCase `yaml:"tests,omitempty" json:"-"`
 }
 
 func (e Entry) String() string {
@@ -64,9 +86,39 @@ func (e Entry) String() string {
 }
 
 func (e Entry) Equals(other Entry) bool {
-	return e.Bang == other.Bang && e.Description == other.Description && e.URL == other.URL && e.Category == other.Category
+	return e.Bang == other.Bang && e.Description == other.Description && e.URL == other.URL && e.Category == other.Category &&
+		slices.Equal(e.Tags, other.Tags) && e.Icon == other.Icon && slices.Equal(e.Examples, other.Examples) &&
+		slices.Equal(e.Aliases, other.Aliases) && e.Hidden == other.Hidden &&
+		e.Deprecated == other.Deprecated && e.Replacement == other.Replacement && e.Extends == other.Extends &&
+		e.Template == other.Template && slices.EqualFunc(e.Tests, other.Tests, TestCase.equals)
+}
+
+// faviconURL guesses the icon of the site a search URL points to.
+func faviconURL(queryURL string) string {
+	u, err := url.Parse(queryURL)
+	if err != nil || u.Host == "" || strings.Contains(u.Host, "{}") {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/favicon.ico"}).String()
 }
 
+var deprecationNotice = template.Must(template.New("deprecated").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Delay}};url={{.Target}}">
+<title>!{{.Bang}} is deprecated</title>
+</head>
+<body>
+<p><strong>!{{.Bang}}</strong> is deprecated{{if .Replacement}}, use <strong>!{{.Replacement}}</strong> instead{{end}}.</p>
+<p>Redirecting to <a href="{{.Target}}">{{.Target}}</a> in {{.Delay}} seconds.</p>
+</body>
+</html>
+`))
+
+// deprecationDelay is how long the deprecation notice is shown, in seconds.
+const deprecationDelay = 3
+
 func (e Entry) Forward(query string, w http.ResponseWriter, r *http.Request) error {
 	u, err := e.URL.Augment(query)
 	if err != nil {
@@ -79,12 +131,75 @@ func (e Entry) Forward(query string, w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
+	if e.Deprecated {
+		slog.Debug("Forwarding with deprecated bang", "bang", e.Bang, "replacement", e.Replacement)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		return deprecationNotice.Execute(w, struct {
+			Bang, Replacement, Target string
+			Delay                     int
+		}{e.Bang, e.Replacement, u.String(), deprecationDelay})
+	}
+
 	http.Redirect(w, r, u.String(), http.StatusFound)
 	return nil
 }
 
-func generateMultiTabHTML(entries []*Entry, query string, w http.ResponseWriter) error {
+// multiTabPage opens every URL in a tab, with links to open them by hand if the browser blocks any.
+var multiTabPage = template.Must(template.New("multitab").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="referrer" content="no-referrer">
+<title>Opening {{len .URLs}} tabs</title>
+<style nonce="{{.Nonce}}">
+body { font-family: sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; }
+li { margin: .3rem 0; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Opening {{len .URLs}} tabs</h1>
+{{range .Deprecated}}<p><strong>!{{.Bang}}</strong> is deprecated{{if .Replacement}}, use <strong>!{{.Replacement}}</strong> instead{{end}}.</p>
+{{end}}<p id="blocked" hidden>Your browser blocked <span id="blocked-count"></span> of the tabs. Allow pop-ups for this site, or open them here:</p>
+<ul>
+{{range .Links}}<li><a href="{{.}}" target="_blank" rel="noopener noreferrer">{{.}}</a></li>
+{{end}}</ul>
+<button id="open-all" type="button">Open all</button>
+<script nonce="{{.Nonce}}">
+const urls = {{.URLs}};
+let pending = urls.slice(1);
+function openPending() {
+	pending = pending.filter((url) => {
+		const tab = window.open(url, "_blank");
+		if (!tab) {
+			return true;
+		}
+		tab.opener = null;
+		return false;
+	});
+	if (pending.length === 0) {
+		window.location.replace(urls[0]);
+		return;
+	}
+	document.getElementById("blocked-count").textContent = pending.length;
+	document.getElementById("blocked").hidden = false;
+}
+document.getElementById("open-all").addEventListener("click", openPending);
+setTimeout(openPending, {{.Delay}} * 1000);
+</script>
+</body>
+</html>
+`))
+
+// multiTabPolicy is the Content-Security-Policy of the multi-tab page when no middleware set one.
+const multiTabPolicy = "default-src 'none'; script-src 'nonce-%[1]s'; style-src 'nonce-%[1]s'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// scriptSchemes are URL schemes that run code in the page opening them.
+var scriptSchemes = []string{"javascript", "data", "vbscript"}
+
+func generateMultiTabHTML(entries []*Entry, query string, w http.ResponseWriter, r *http.Request) error {
 	urls := make([]string, len(entries))
+	links := make([]template.URL, len(entries))
+	var deprecated []*Entry
 	for i, entry := range entries {
 		u, err := entry.URL.Augment(query)
 		if err != nil {
@@ -96,28 +211,45 @@ func generateMultiTabHTML(entries []*Entry, query string, w http.ResponseWriter)
 			}
 			return err
 		}
+		if slices.Contains(scriptSchemes, strings.ToLower(u.Scheme)) {
+			err = fmt.Errorf("refusing to open a %s URL of bang '%s'", u.Scheme, entry.Bang)
+			slog.Error("Unsafe URL in multi-bang", "err", err)
+			http.Error(w, "Refusing to open a URL that would run a script", http.StatusBadRequest)
+			return err
+		}
 		urls[i] = u.String()
+		// The scheme is checked above, so links to apps like obsidian:// work.
+		links[i] = template.URL(urls[i])
+		if entry.Deprecated {
+			deprecated = append(deprecated, entry)
+		}
 	}
-
-	slog.Debug("Generated URLs for multi-bang", "urls", urls)
-
-	var newTabCommands []string
-	for i := 1; i < len(urls); i++ {
-		newTabCommands = append(newTabCommands, fmt.Sprintf("window.open('%s', '_blank');", urls[i]))
+	delay := 0
+	if len(deprecated) > 0 {
+		slog.Debug("Opening tabs with deprecated bangs", "count", len(deprecated))
+		delay = deprecationDelay
 	}
-	newTabsJS := strings.Join(newTabCommands, "\n")
 
-	w.Header().Set("Content-Type", "text/html")
-	hypertext := fmt.Sprintf(`<html>
-<head></head>
-<body>
-<script>
-%s
-window.location.href = "%s";
-</script>
-</body>
-</html>`, newTabsJS, urls[0])
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		logged := make([]string, len(urls))
+		for i, u := range urls {
+			logged[i] = middleware.RedactURL(u)
+		}
+		slog.Debug("Generated URLs for multi-bang", "urls", logged)
+	}
 
-	w.Write([]byte(hypertext))
-	return nil
+	nonce := middleware.CSPNonce(r)
+	if nonce == "" {
+		nonce = middleware.NewCSPNonce()
+		w.Header().Set("Content-Security-Policy", fmt.Sprintf(multiTabPolicy, nonce))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	return multiTabPage.Execute(w, struct {
+		URLs       []string
+		Links      []template.URL
+		Deprecated []*Entry
+		Delay      int
+		Nonce      string
+	}{urls, links, deprecated, delay, nonce})
 }
@@ -3,8 +3,13 @@ package bangs
 import (
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
 )
 
 func TestQueryUrl_Augment(t *testing.T) {
@@ -441,3 +446,59 @@ func BenchmarkAugment(b *testing.B) {
 		}
 	}
 }
+
+func TestGenerateMultiTabHTML(t *testing.T) {
+	entries := []*Entry{
+		{Bang: "a", URL: "https://a.example.com/?q={}"},
+		{Bang: "b", URL: "https://b.example.com/{}"},
+		{Bang: "o", URL: "obsidian://search?query={}"},
+	}
+	query := `x'); alert(1); //</script><script>alert(2)</script>`
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := generateMultiTabHTML(entries, query, w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "alert(1)") || strings.Contains(body, "<script>alert") {
+		t.Errorf("expected the query to be escaped, got %s", body)
+	}
+	policy := w.Header().Get("Content-Security-Policy")
+	nonce := strings.TrimSuffix(strings.TrimPrefix(regexp.MustCompile(`'nonce-[^']+'`).FindString(policy), "'nonce-"), "'")
+	if nonce == "" || strings.Count(body, `nonce="`+nonce+`"`) != 2 {
+		t.Errorf("expected the script and style to carry the nonce of the policy %q, got %s", policy, body)
+	}
+	for _, want := range []string{
+		`href="https://a.example.com/?q=x%27%29%3B`,
+		`href="obsidian://search?query=x%27%29%3B`,
+		`id="open-all"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in the page, got %s", want, body)
+		}
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	middleware.SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		generateMultiTabHTML(entries, "a", w, r)
+	})).ServeHTTP(w, r)
+	policy = w.Header().Get("Content-Security-Policy")
+	nonce = strings.TrimSuffix(strings.TrimPrefix(regexp.MustCompile(`'nonce-[^']+'`).FindString(policy), "'nonce-"), "'")
+	if !strings.Contains(policy, "'self'") || !strings.Contains(w.Body.String(), `nonce="`+nonce+`"`) {
+		t.Errorf("expected the page to use the nonce of the middleware's policy %q, got %s", policy, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	err := generateMultiTabHTML([]*Entry{entries[0], {Bang: "js", URL: "javascript:alert({})"}}, "a", w, httptest.NewRequest("GET", "/", nil))
+	if err == nil || w.Code != http.StatusBadRequest {
+		t.Errorf("expected a javascript: URL to be refused, got %d %v", w.Code, err)
+	}
+
+	w = httptest.NewRecorder()
+	generateMultiTabHTML([]*Entry{entries[0], {Bang: "old", URL: "https://old.example.com/?q={}", Deprecated: true, Replacement: "a"}}, "a", w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<strong>!old</strong> is deprecated, use <strong>!a</strong> instead") || !regexp.MustCompile(`setTimeout\(openPending, +3 +\* 1000\)`).MatchString(body) {
+		t.Errorf("expected a deprecation notice before the tabs open, got %s", body)
+	}
+}
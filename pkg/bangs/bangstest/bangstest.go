@@ -0,0 +1,26 @@
+// Package bangstest runs the tests declared in bangs files from Go tests.
+package bangstest
+
+import (
+	"testing"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+// CheckFile reports every test case of the registry file at path that fails, using the current options.
+func CheckFile(t testing.TB, path string) {
+	t.Helper()
+	reg, err := bangs.ParseFile(path, "")
+	if err != nil {
+		t.Fatalf("parsing %s: %v", path, err)
+	}
+	Check(t, reg)
+}
+
+// Check reports every failing test case of reg.
+func Check(t testing.TB, reg *bangs.Registry) {
+	t.Helper()
+	for _, failure := range reg.RunTests() {
+		t.Errorf("%s", failure)
+	}
+}
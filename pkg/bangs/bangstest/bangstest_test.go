@@ -0,0 +1,7 @@
+package bangstest
+
+import "testing"
+
+func TestCheckFile_ProjectRegistry(t *testing.T) {
+	CheckFile(t, "../../../bangs.yaml")
+}
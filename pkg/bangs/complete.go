@@ -0,0 +1,315 @@
+package bangs
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Completion is a bang or alias suggested for a typed prefix.
+type Completion struct {
+	Bang        string `json:"bang"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Alias       bool   `json:"alias,omitempty"`
+	// Target is what an alias resolves to.
+	Target     string `json:"target,omitempty"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+	// Uses is the local usage count, if usage statistics are enabled.
+	Uses int `json:"uses,omitempty"`
+}
+
+// matchQuality ranks how well a completion matches the typed prefix.
+type matchQuality int
+
+const (
+	noMatch matchQuality = iota
+	fuzzyMatch
+	descriptionMatch
+	substringMatch
+	namePrefixMatch
+	bangPrefixMatch
+	exactMatch
+)
+
+type completionItem struct {
+	Completion
+	// Lower-cased for matching; bangs holds the bang followed by the entry's aliases.
+	bangs       []string
+	name        string
+	description string
+	// counted is the bang whose uses count for the item, the target's for aliases.
+	counted string
+}
+
+// isSubsequence reports whether the characters of text appear in s in order.
+func isSubsequence(text, s string) bool {
+	for _, r := range s {
+		if len(text) == 0 {
+			break
+		}
+		if strings.HasPrefix(text, string(r)) {
+			text = text[len(string(r)):]
+		}
+	}
+	return len(text) == 0
+}
+
+type completionKey struct {
+	key  string
+	item int
+}
+
+// maxGram is the length of the longest n-grams in completionIndex.
+const maxGram = 3
+
+// completionIndex holds the listed entries and aliases of a registry, built once per load.
+type completionIndex struct {
+	// items are the entries in declaration order, then the aliases sorted by name.
+	items []completionItem
+	// keys holds every lower-cased bang sorted, for prefix lookups.
+	keys []completionKey
+	// words holds every lower-cased word of the names sorted.
+	words []completionKey
+	// grams map every substring of up to maxGram bytes to the items holding it, ascending.
+	grams            map[string][]int
+	descriptionGrams map[string][]int
+}
+
+// addGrams adds the n-grams of text to grams for item, which must not be lower than earlier items.
+func addGrams(grams map[string][]int, text string, item int) {
+	for i := range len(text) {
+		for n := 1; n <= maxGram && i+n <= len(text); n++ {
+			gram := text[i : i+n]
+			list := grams[gram]
+			if len(list) == 0 || list[len(list)-1] != item {
+				grams[gram] = append(list, item)
+			}
+		}
+	}
+}
+
+// candidates returns the items of grams holding the rarest n-gram of text.
+func candidates(grams map[string][]int, text string) []int {
+	if len(text) <= maxGram {
+		return grams[text]
+	}
+	best := grams[text[:maxGram]]
+	for i := 1; i+maxGram <= len(text); i++ {
+		if list := grams[text[i:i+maxGram]]; len(list) < len(best) {
+			best = list
+		}
+	}
+	return best
+}
+
+// prefixed returns the keys starting with text.
+func prefixed(keys []completionKey, text string) []completionKey {
+	i := sort.Search(len(keys), func(i int) bool {
+		return keys[i].key >= text
+	})
+	j := i
+	for j < len(keys) && strings.HasPrefix(keys[j].key, text) {
+		j++
+	}
+	return keys[i:j]
+}
+
+func newCompletionIndex(r *Registry) *completionIndex {
+	idx := &completionIndex{grams: make(map[string][]int), descriptionGrams: make(map[string][]int)}
+	add := func(c Completion, bangs []string, counted string) {
+		item := len(idx.items)
+		lower := make([]string, 0, len(bangs))
+		for _, bang := range bangs {
+			bang = strings.ToLower(strings.TrimSpace(bang))
+			lower = append(lower, bang)
+			idx.keys = append(idx.keys, completionKey{key: bang, item: item})
+			addGrams(idx.grams, bang, item)
+		}
+		name, description := strings.ToLower(c.Name), strings.ToLower(c.Description)
+		for _, word := range strings.Fields(name) {
+			idx.words = append(idx.words, completionKey{key: word, item: item})
+		}
+		addGrams(idx.grams, name, item)
+		addGrams(idx.descriptionGrams, description, item)
+		idx.items = append(idx.items, completionItem{
+			Completion:  c,
+			bangs:       lower,
+			name:        name,
+			description: description,
+			counted:     counted,
+		})
+	}
+
+	for _, entry := range r.Entries.Ordered() {
+		if entry.Hidden {
+			continue
+		}
+		add(Completion{
+			Bang:        entry.Bang,
+			Name:        entry.Name,
+			Description: entry.Description,
+			Category:    entry.Category,
+			Deprecated:  entry.Deprecated,
+		}, append([]string{entry.Bang}, entry.Aliases...), entry.Bang)
+	}
+
+	aliases := make([]string, 0, len(r.Aliases))
+	for alias := range r.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		target := r.Aliases[alias]
+		c := Completion{
+			Bang:        alias,
+			Name:        alias,
+			Description: "Alias for " + target,
+			Alias:       true,
+			Target:      target,
+		}
+		counted := target
+		if entry, ok := r.Entries.byBang[target]; ok {
+			c.Category = entry.Category
+			counted = entry.Bang
+		}
+		add(c, []string{alias}, counted)
+	}
+
+	sort.SliceStable(idx.keys, func(i, j int) bool {
+		return idx.keys[i].key < idx.keys[j].key
+	})
+	sort.SliceStable(idx.words, func(i, j int) bool {
+		return idx.words[i].key < idx.words[j].key
+	})
+	return idx
+}
+
+// Complete returns at most limit entries and aliases matching prefix, best matches and most uses first.
+func (r *Registry) Complete(prefix string, limit int, uses map[string]int) []Completion {
+	idx := r.completions
+	if idx == nil {
+		idx = newCompletionIndex(r)
+	}
+	completions := make([]Completion, 0)
+	text := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(prefix), "!")))
+	if text == "" {
+		return completions
+	}
+
+	quality := make(map[int]matchQuality)
+	for _, k := range prefixed(idx.keys, text) {
+		q := bangPrefixMatch
+		if k.key == text {
+			q = exactMatch
+		}
+		quality[k.item] = max(quality[k.item], q)
+	}
+
+	// Each kind of match ranks below the ones before, so it is only looked up while there is room.
+	room := func() bool {
+		return limit == 0 || len(quality) < limit
+	}
+	add := func(item int, q matchQuality) {
+		if _, ok := quality[item]; !ok {
+			quality[item] = q
+		}
+	}
+	if room() {
+		for _, k := range prefixed(idx.words, text) {
+			add(k.item, namePrefixMatch)
+		}
+	}
+	if room() {
+		for _, i := range candidates(idx.grams, text) {
+			item := &idx.items[i]
+			if strings.Contains(item.name, text) || slices.ContainsFunc(item.bangs, func(bang string) bool {
+				return strings.Contains(bang, text)
+			}) {
+				add(i, substringMatch)
+			}
+		}
+	}
+	if room() {
+		for _, i := range candidates(idx.descriptionGrams, text) {
+			if strings.Contains(idx.items[i].description, text) {
+				add(i, descriptionMatch)
+			}
+		}
+	}
+	if room() {
+		// Only items holding the rarest byte of text can match it fuzzily.
+		var fuzzy []int
+		for i := range len(text) {
+			if list := idx.grams[text[i:i+1]]; i == 0 || len(list) < len(fuzzy) {
+				fuzzy = list
+			}
+		}
+		for _, i := range fuzzy {
+			item := &idx.items[i]
+			if isSubsequence(text, item.bangs[0]) || isSubsequence(text, item.name) {
+				add(i, fuzzyMatch)
+			}
+		}
+	}
+
+	found := make([]int, 0, len(quality))
+	for i := range quality {
+		found = append(found, i)
+	}
+	sort.Slice(found, func(a, b int) bool {
+		itemA, itemB := &idx.items[found[a]], &idx.items[found[b]]
+		if quality[found[a]] != quality[found[b]] {
+			return quality[found[a]] > quality[found[b]]
+		}
+		if usesA, usesB := uses[itemA.counted], uses[itemB.counted]; usesA != usesB {
+			return usesA > usesB
+		}
+		if len(itemA.Bang) != len(itemB.Bang) {
+			return len(itemA.Bang) < len(itemB.Bang)
+		}
+		return found[a] < found[b]
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	for _, i := range found {
+		c := idx.items[i].Completion
+		c.Uses = uses[idx.items[i].counted]
+		completions = append(completions, c)
+	}
+	return completions
+}
+
+// CompleteHandler serves completions of the prefix query parameter, ranked by usage unless usage=false.
+func CompleteHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries := r.URL.Query()
+		limit := 10
+		if l := queries.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("Invalid limit '%s'", l), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		var uses map[string]int
+		if stats := usage; stats != nil && queries.Get("usage") != "false" {
+			uses = stats.Counts()
+		}
+		reg := RequestRegistry(r)
+		completions := make([]Completion, 0)
+		if reg != nil {
+			completions = reg.Complete(queries.Get("prefix"), limit, uses)
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Prefix      string       `json:"prefix"`
+			Completions []Completion `json:"completions"`
+		}{queries.Get("prefix"), completions})
+	})
+}
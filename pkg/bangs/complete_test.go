@@ -0,0 +1,149 @@
+package bangs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const completeRegistry = `
+aliases:
+  code: 'gh'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  description: 'Web search'
+  category: 'Search'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+  description: 'Code hosting'
+  category: 'Development'
+  aliases: ['hub']
+GitLab:
+  bang: 'gl'
+  url: 'https://gitlab.com/search?search={}'
+  category: 'Development'
+Go Packages:
+  bang: 'pkg'
+  url: 'https://pkg.go.dev/search?q={}'
+  description: 'Search Go modules'
+Secret:
+  bang: 'gs'
+  url: 'https://example.com/?q={}'
+  hidden: true
+`
+
+func TestRegistry_Complete(t *testing.T) {
+	reg, err := Parse([]byte(completeRegistry), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bangsOf := func(completions []Completion) []string {
+		bangs := make([]string, 0, len(completions))
+		for _, c := range completions {
+			bangs = append(bangs, c.Bang)
+		}
+		return bangs
+	}
+	tests := []struct {
+		prefix string
+		limit  int
+		uses   map[string]int
+		want   []string
+	}{
+		{"g", 0, nil, []string{"g", "gh", "gl", "pkg", "code"}},
+		{"!G", 2, nil, []string{"g", "gh"}},
+		{"g", 3, map[string]int{"gl": 3}, []string{"g", "gl", "gh"}},
+		{"hub", 0, nil, []string{"gh"}},
+		{"co", 0, nil, []string{"code", "gh"}},
+		{"git", 0, nil, []string{"gh", "gl"}},
+		{"modules", 0, nil, []string{"pkg"}},
+		{"gthb", 0, nil, []string{"gh"}},
+		{"zzz", 0, nil, []string{}},
+		{"", 0, nil, []string{}},
+	}
+	for _, tt := range tests {
+		got := bangsOf(reg.Complete(tt.prefix, tt.limit, tt.uses))
+		if len(got) != len(tt.want) {
+			t.Errorf("Complete(%q): expected %v, got %v", tt.prefix, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Complete(%q): expected %v, got %v", tt.prefix, tt.want, got)
+				break
+			}
+		}
+	}
+
+	completions := reg.Complete("code", 1, nil)
+	want := Completion{Bang: "code", Name: "code", Description: "Alias for gh", Category: "Development", Alias: true, Target: "gh"}
+	if len(completions) != 1 || completions[0] != want {
+		t.Errorf("expected %+v, got %+v", want, completions)
+	}
+}
+
+func TestCompleteHandler(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	defer SetUsageStats(nil)
+
+	reg, err := Parse([]byte(completeRegistry), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+	stats, err := OpenUsageStats(filepath.Join(t.TempDir(), "stats.json"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.Record("gl", time.Now())
+	stats.Record("gh", time.Now())
+	stats.Record("gh", time.Now())
+	SetUsageStats(stats)
+
+	get := func(target string) (int, []Completion) {
+		w := httptest.NewRecorder()
+		CompleteHandler().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var response struct {
+			Completions []Completion `json:"completions"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Completions
+	}
+
+	code, completions := get("/complete?prefix=gl&limit=2")
+	if code != http.StatusOK || len(completions) == 0 || completions[0].Bang != "gl" || completions[0].Uses != 1 {
+		t.Errorf("expected the use of GitLab, got %d %+v", code, completions)
+	}
+	_, completions = get("/complete?prefix=g&limit=2")
+	if len(completions) != 2 || completions[1].Bang != "gh" || completions[1].Uses != 2 {
+		t.Errorf("expected the more used GitHub to rank second, got %+v", completions)
+	}
+	_, completions = get("/complete?prefix=code")
+	if len(completions) == 0 || completions[0].Bang != "code" || completions[0].Uses != 2 {
+		t.Errorf("expected the alias to count the uses of its target, got %+v", completions)
+	}
+	_, completions = get("/complete?prefix=g&limit=2&usage=false")
+	if len(completions) != 2 || completions[1].Bang != "gh" || completions[1].Uses != 0 {
+		t.Errorf("expected usage to be ignored with usage=false, got %+v", completions)
+	}
+	if code, _ := get("/complete?prefix=g&limit=-1"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", code)
+	}
+}
+
+func BenchmarkRegistry_Complete(b *testing.B) {
+	reg, err := ParseFile("../../bangs.yaml", FormatYAML)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		reg.Complete("g", 10, nil)
+	}
+}
@@ -0,0 +1,568 @@
+package bangs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// registryDocument is a registry file as a yaml.Node tree, so edits keep its comments and layout.
+type registryDocument struct {
+	doc  yaml.Node
+	root *yaml.Node
+	// entries holds the entries: the root in version 1 files, the bangs map in version 2.
+	entries *yaml.Node
+	legacy  bool
+
+	// yaml.v3 drops blank lines, so bytes() restores them from here.
+	blankBefore map[*yaml.Node]int
+	separated   bool
+}
+
+type EditNotFoundError string
+
+func (e EditNotFoundError) Error() string {
+	return fmt.Sprintf("'%s' not found", string(e))
+}
+
+type EditConflictError string
+
+func (e EditConflictError) Error() string {
+	return fmt.Sprintf("'%s' already exists", string(e))
+}
+
+// reserved reports whether name is a top level key that cannot name a version 1 entry.
+func (d *registryDocument) reserved(name string) bool {
+	return d.legacy && (name == "default" || name == "aliases" || name == "version")
+}
+
+func openRegistryDocument(data []byte) (*registryDocument, error) {
+	d := &registryDocument{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		err := yaml.Unmarshal(data, &d.doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.doc.Kind == 0 {
+		d.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	d.root = d.doc.Content[0]
+	if d.root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("registry document is not a mapping")
+	}
+
+	var err error
+	d.entries, err = EntriesMapping(d.root)
+	if err != nil {
+		return nil, err
+	}
+	d.legacy = d.entries == d.root
+
+	lines := strings.Split(string(data), "\n")
+	d.blankBefore = make(map[*yaml.Node]int)
+	separated, keys := 0, 0
+	for _, mapping := range d.trackedMappings() {
+		for i := 2; i < len(mapping.Content); i += 2 {
+			key := mapping.Content[i]
+			blanks := 0
+			for line := key.Line - 2 - commentLines(key.HeadComment); line >= 0 && line < len(lines) && strings.TrimSpace(lines[line]) == ""; line-- {
+				blanks++
+			}
+			d.blankBefore[key] = blanks
+			keys++
+			if blanks > 0 {
+				separated++
+			}
+		}
+	}
+	d.separated = keys == 0 || separated*2 >= keys
+	return d, nil
+}
+
+// trackedMappings are the mappings whose blank lines between keys are kept.
+func (d *registryDocument) trackedMappings() []*yaml.Node {
+	if d.entries == d.root {
+		return []*yaml.Node{d.root}
+	}
+	return []*yaml.Node{d.root, d.entries}
+}
+
+func commentLines(comment string) int {
+	if comment == "" {
+		return 0
+	}
+	return strings.Count(comment, "\n") + 1
+}
+
+func (d *registryDocument) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(&d.doc)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-read the output to learn on which lines the keys ended up.
+	reread, err := openRegistryDocument(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	tracked, encoded := d.trackedMappings(), reread.trackedMappings()
+	if len(tracked) != len(encoded) {
+		return buf.Bytes(), nil
+	}
+	insertBlanks := make(map[int]int)
+	for m := range tracked {
+		if len(tracked[m].Content) != len(encoded[m].Content) {
+			return buf.Bytes(), nil
+		}
+		for i := 2; i < len(tracked[m].Content); i += 2 {
+			blanks, known := d.blankBefore[tracked[m].Content[i]]
+			if !known && d.separated {
+				blanks = 1
+			}
+			key := encoded[m].Content[i]
+			insertBlanks[key.Line-1-commentLines(key.HeadComment)] = blanks
+		}
+	}
+
+	var out bytes.Buffer
+	for i, line := range strings.SplitAfter(buf.String(), "\n") {
+		out.WriteString(strings.Repeat("\n", insertBlanks[i]))
+		out.WriteString(line)
+	}
+	return out.Bytes(), nil
+}
+
+// EntriesMapping returns the entries mapping of a registry root, adding a missing version 2 bangs map.
+func EntriesMapping(root *yaml.Node) (*yaml.Node, error) {
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		return root, nil
+	}
+	i := mappingIndex(root, "bangs")
+	if i < 0 {
+		root.Content = append(root.Content, stringNode("bangs"), &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		i = len(root.Content) - 2
+	}
+	if root.Content[i+1].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("bangs is not a mapping")
+	}
+	return root.Content[i+1], nil
+}
+
+// mappingIndex returns the index of key in the content of a mapping node, or -1.
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// removePair removes the pair at index i of a mapping, handing its head comment to the next key.
+func removePair(mapping *yaml.Node, i int) {
+	key := mapping.Content[i]
+	if key.HeadComment != "" && i+2 < len(mapping.Content) {
+		next := mapping.Content[i+2]
+		if next.HeadComment == "" {
+			next.HeadComment = key.HeadComment
+		} else {
+			next.HeadComment = key.HeadComment + "\n\n" + next.HeadComment
+		}
+	}
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func quotedNode(value string) *yaml.Node {
+	n := stringNode(value)
+	n.Style = yaml.SingleQuotedStyle
+	return n
+}
+
+// setField sets a field of an entry mapping, removing empty optional ones.
+func setField(mapping *yaml.Node, key, value string, optional bool) {
+	i := mappingIndex(mapping, key)
+	if i < 0 {
+		if value == "" && optional {
+			return
+		}
+		mapping.Content = append(mapping.Content, stringNode(key), quotedNode(value))
+		return
+	}
+	if value == "" && optional {
+		removePair(mapping, i)
+		return
+	}
+	node := mapping.Content[i+1]
+	if node.Kind != yaml.ScalarNode {
+		mapping.Content[i+1] = quotedNode(value)
+		return
+	}
+	node.Value = value
+	node.Tag = "!!str"
+}
+
+// setListField sets a list field as a flow sequence, removing it when empty.
+func setListField(mapping *yaml.Node, key string, values []string) {
+	i := mappingIndex(mapping, key)
+	if len(values) == 0 {
+		if i >= 0 {
+			removePair(mapping, i)
+		}
+		return
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+	for _, value := range values {
+		list.Content = append(list.Content, quotedNode(value))
+	}
+	if i < 0 {
+		mapping.Content = append(mapping.Content, stringNode(key), list)
+		return
+	}
+	if old := mapping.Content[i+1]; old.Kind == yaml.SequenceNode {
+		list.Style = old.Style
+	}
+	mapping.Content[i+1] = list
+}
+
+// setBoolField sets a flag of an entry, removing it when false.
+func setBoolField(mapping *yaml.Node, key string, value bool) {
+	i := mappingIndex(mapping, key)
+	switch {
+	case !value && i >= 0:
+		removePair(mapping, i)
+	case value && i < 0:
+		mapping.Content = append(mapping.Content, stringNode(key), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	case value:
+		mapping.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}
+	}
+}
+
+// explicitIcon returns the icon of e unless it is the favicon derived from its URL.
+func explicitIcon(e Entry) string {
+	if e.Icon == faviconURL(string(e.URL)) {
+		return ""
+	}
+	return e.Icon
+}
+
+func setEntryFields(mapping *yaml.Node, e Entry) {
+	setField(mapping, "bang", e.Bang, false)
+	setField(mapping, "url", string(e.URL), e.Extends != "")
+	setField(mapping, "description", e.Description, true)
+	setField(mapping, "category", e.Category, true)
+	setListField(mapping, "tags", e.Tags)
+	setField(mapping, "icon", explicitIcon(e), true)
+	setListField(mapping, "examples", e.Examples)
+	setListField(mapping, "aliases", e.Aliases)
+	setBoolField(mapping, "hidden", e.Hidden)
+	setBoolField(mapping, "deprecated", e.Deprecated && e.Replacement == "")
+	setField(mapping, "replacement", e.Replacement, true)
+	setField(mapping, "extends", e.Extends, true)
+}
+
+func (d *registryDocument) entry(name string) (*yaml.Node, error) {
+	i := mappingIndex(d.entries, name)
+	if i < 0 || d.reserved(name) || d.entries.Content[i+1].Kind != yaml.MappingNode {
+		return nil, EditNotFoundError(name)
+	}
+	return d.entries.Content[i+1], nil
+}
+
+func (d *registryDocument) createEntry(name string, e Entry) error {
+	if d.reserved(name) {
+		return EditInvalidError{fmt.Errorf("'%s' is reserved and cannot be used as entry name", name)}
+	}
+	if mappingIndex(d.entries, name) >= 0 {
+		return EditConflictError(name)
+	}
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setEntryFields(mapping, e)
+	d.entries.Content = append(d.entries.Content, stringNode(name), mapping)
+	return nil
+}
+
+func (d *registryDocument) updateEntry(name string, e Entry) error {
+	mapping, err := d.entry(name)
+	if err != nil {
+		return err
+	}
+	setEntryFields(mapping, e)
+	return nil
+}
+
+func (d *registryDocument) renameEntry(name, newName string) error {
+	if _, err := d.entry(name); err != nil {
+		return err
+	}
+	if name == newName {
+		return nil
+	}
+	if d.reserved(newName) {
+		return EditInvalidError{fmt.Errorf("'%s' is reserved and cannot be used as entry name", newName)}
+	}
+	if mappingIndex(d.entries, newName) >= 0 {
+		return EditConflictError(newName)
+	}
+	d.entries.Content[mappingIndex(d.entries, name)].Value = newName
+	return nil
+}
+
+func (d *registryDocument) deleteEntry(name string) error {
+	if _, err := d.entry(name); err != nil {
+		return err
+	}
+	removePair(d.entries, mappingIndex(d.entries, name))
+	return nil
+}
+
+// aliases returns the aliases mapping, creating it after the default if create is set.
+func (d *registryDocument) aliases(create bool) *yaml.Node {
+	i := mappingIndex(d.root, "aliases")
+	if i >= 0 && d.root.Content[i+1].Kind == yaml.MappingNode {
+		return d.root.Content[i+1]
+	}
+	if !create {
+		return nil
+	}
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if i >= 0 {
+		d.root.Content[i+1] = mapping
+		return mapping
+	}
+	at := 0
+	if def := mappingIndex(d.root, "default"); def >= 0 {
+		at = def + 2
+	} else if v := mappingIndex(d.root, "version"); v >= 0 && !d.legacy {
+		at = v + 2
+	}
+	content := append([]*yaml.Node{}, d.root.Content[:at]...)
+	content = append(content, stringNode("aliases"), mapping)
+	d.root.Content = append(content, d.root.Content[at:]...)
+	return mapping
+}
+
+func (d *registryDocument) setAlias(alias, target string, create bool) error {
+	mapping := d.aliases(create)
+	if mapping == nil {
+		return EditNotFoundError(alias)
+	}
+	i := mappingIndex(mapping, alias)
+	switch {
+	case create && i >= 0:
+		return EditConflictError(alias)
+	case !create && i < 0:
+		return EditNotFoundError(alias)
+	case create:
+		mapping.Content = append(mapping.Content, stringNode(alias), quotedNode(target))
+	case mapping.Content[i+1].Kind == yaml.MappingNode:
+		// Aliases with tests keep them and only change their target.
+		setField(mapping.Content[i+1], "target", target, false)
+	default:
+		mapping.Content[i+1].Value = target
+		mapping.Content[i+1].Tag = "!!str"
+	}
+	return nil
+}
+
+func (d *registryDocument) renameAlias(alias, newAlias string) error {
+	mapping := d.aliases(false)
+	if mapping == nil || mappingIndex(mapping, alias) < 0 {
+		return EditNotFoundError(alias)
+	}
+	if alias == newAlias {
+		return nil
+	}
+	if mappingIndex(mapping, newAlias) >= 0 {
+		return EditConflictError(newAlias)
+	}
+	mapping.Content[mappingIndex(mapping, alias)].Value = newAlias
+	return nil
+}
+
+func (d *registryDocument) deleteAlias(alias string) error {
+	mapping := d.aliases(false)
+	if mapping == nil || mappingIndex(mapping, alias) < 0 {
+		return EditNotFoundError(alias)
+	}
+	removePair(mapping, mappingIndex(mapping, alias))
+	return nil
+}
+
+// editFile applies edit to the YAML registry file at path unless it adds parse or validation problems.
+func editFile(path string, edit func(d *registryDocument) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	before, err := Parse(data, FormatYAML)
+	if err != nil {
+		return fmt.Errorf("current registry file is invalid: %w", err)
+	}
+	known := make(map[string]bool)
+	for _, problem := range before.Validate() {
+		known[problem.Error()] = true
+	}
+
+	d, err := openRegistryDocument(data)
+	if err != nil {
+		return err
+	}
+	err = edit(d)
+	if err != nil {
+		return err
+	}
+	updated, err := d.bytes()
+	if err != nil {
+		return err
+	}
+
+	after, err := Parse(updated, FormatYAML)
+	if err != nil {
+		return EditInvalidError{err}
+	}
+	for _, problem := range after.Validate() {
+		if !known[problem.Error()] {
+			return EditInvalidError{problem}
+		}
+	}
+
+	err = replaceFile(path, updated)
+	if err != nil {
+		return err
+	}
+	return LoadFormat(path, FormatYAML)
+}
+
+// Document is a YAML registry file opened to add entries to it.
+type Document struct {
+	path string
+	d    *registryDocument
+}
+
+// OpenDocument opens the YAML registry file at path, or an empty one if it is missing.
+func OpenDocument(path string) (*Document, error) {
+	if format := FormatFromPath(path); format != FormatYAML {
+		return nil, fmt.Errorf("only YAML registry files can be edited, '%s' is %s", path, format)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	d, err := openRegistryDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("registry file '%s': %w", path, err)
+	}
+	return &Document{path: path, d: d}, nil
+}
+
+// Taken returns the entry names and bangs, including entry aliases, of the document.
+func (doc *Document) Taken() (names, bangs map[string]bool) {
+	names, bangs = make(map[string]bool), make(map[string]bool)
+	entries := doc.d.entries.Content
+	for i := 0; i+1 < len(entries); i += 2 {
+		names[entries[i].Value] = true
+		mapping := entries[i+1]
+		if mapping.Kind != yaml.MappingNode {
+			continue
+		}
+		if j := mappingIndex(mapping, "bang"); j >= 0 {
+			bangs[strings.TrimSpace(mapping.Content[j+1].Value)] = true
+		}
+		if j := mappingIndex(mapping, "aliases"); j >= 0 {
+			for _, alias := range mapping.Content[j+1].Content {
+				bangs[strings.TrimSpace(alias.Value)] = true
+			}
+		}
+	}
+	return names, bangs
+}
+
+// AddEntry adds an entry at the end of the document.
+func (doc *Document) AddEntry(name string, e Entry) error {
+	return doc.d.createEntry(name, e)
+}
+
+// Save replaces the file with the document.
+func (doc *Document) Save() error {
+	data, err := doc.d.bytes()
+	if err != nil {
+		return err
+	}
+	return replaceFile(doc.path, data)
+}
+
+// replaceFile atomically replaces the file at path, or the target of its symlink, keeping its permissions.
+func replaceFile(path string, data []byte) error {
+	mode := fs.FileMode(0o644)
+	resolved, err := filepath.EvalSymlinks(path)
+	switch {
+	case err == nil:
+		path = resolved
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		mode = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), path)
+	// A file mounted on its own, as in a container, cannot be renamed over.
+	if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+		slog.Warn("Cannot replace the registry file, writing it in place", "file", path, "err", err)
+		return os.WriteFile(path, data, mode)
+	}
+	return err
+}
+
+// EditInvalidError is returned when an edit would leave the registry invalid.
+type EditInvalidError struct {
+	Err error
+}
+
+func (e EditInvalidError) Error() string {
+	return fmt.Sprintf("change rejected: %v", e.Err)
+}
+
+func (e EditInvalidError) Unwrap() error {
+	return e.Err
+}
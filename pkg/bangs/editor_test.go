@@ -0,0 +1,262 @@
+package bangs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikkadev/bangs/internal/watcher"
+	"gopkg.in/yaml.v3"
+)
+
+const editorTestRegistry = `# Team bangs
+default: 'g'
+
+aliases:
+  search: 'g' # plain search
+
+# ===== Search =====
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  description: 'Search Google'
+
+# ===== Development =====
+GitHub:
+  bang: "gh"
+  url: "https://github.com/search?q={}"
+  category: 'Development' # keep me
+`
+
+func TestEditorHandler(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	path := filepath.Join(t.TempDir(), "bangs.yaml")
+	err := os.WriteFile(path, []byte(editorTestRegistry), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := EditorHandler(path, "", "secret")
+
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	steps := []struct {
+		name, method, target, body, token string
+		status                            int
+	}{
+		{"no token", "POST", "/entries", `{}`, "", http.StatusUnauthorized},
+		{"wrong token", "POST", "/entries", `{}`, "nope", http.StatusUnauthorized},
+		{"create entry", "POST", "/entries", `{"name": "StackOverflow", "bang": "so", "url": "https://stackoverflow.com/search?q={}", "category": "Development"}`, "secret", http.StatusCreated},
+		{"create duplicate name", "POST", "/entries", `{"name": "Google", "bang": "gg", "url": "https://google.de/?q={}"}`, "secret", http.StatusConflict},
+		{"create duplicate bang", "POST", "/entries", `{"name": "Google2", "bang": "g", "url": "https://google.de/?q={}"}`, "secret", http.StatusUnprocessableEntity},
+		{"create without placeholder", "POST", "/entries", `{"name": "Broken", "bang": "br", "url": "https://example.com/"}`, "secret", http.StatusUnprocessableEntity},
+		{"create reserved name", "POST", "/entries", `{"name": "aliases", "bang": "al", "url": "https://example.com/?q={}"}`, "secret", http.StatusUnprocessableEntity},
+		{"update and rename", "PUT", "/entries/GitHub", `{"name": "GitHub Code", "bang": "ghc", "url": "https://github.com/search?type=code&q={}", "category": "Development"}`, "secret", http.StatusOK},
+		{"update metadata", "PUT", "/entries/GitHub%20Code", `{"bang": "ghc", "url": "https://github.com/search?type=code&q={}", "category": "Development", "tags": ["code", "git"], "hidden": true, "icon": "https://github.githubassets.com/favicon.svg"}`, "secret", http.StatusOK},
+		{"update with derived icon", "PUT", "/entries/Google", `{"bang": "g", "url": "https://www.google.com/search?q={}", "description": "Search Google", "icon": "https://www.google.com/favicon.ico"}`, "secret", http.StatusOK},
+		{"update unknown", "PUT", "/entries/Nope", `{"bang": "n", "url": "https://example.com/?q={}"}`, "secret", http.StatusNotFound},
+		{"delete section head", "DELETE", "/entries/Google", ``, "secret", http.StatusUnprocessableEntity},
+		{"create alias", "POST", "/aliases", `{"alias": "dev", "target": "ghc+so"}`, "secret", http.StatusCreated},
+		{"alias to unknown bang", "POST", "/aliases", `{"alias": "bad", "target": "nope"}`, "secret", http.StatusUnprocessableEntity},
+		{"rename alias", "PUT", "/aliases/search", `{"alias": "s"}`, "secret", http.StatusOK},
+		{"delete alias", "DELETE", "/aliases/dev", ``, "secret", http.StatusNoContent},
+		{"delete unknown alias", "DELETE", "/aliases/dev", ``, "secret", http.StatusNotFound},
+		{"delete entry", "DELETE", "/entries/StackOverflow", ``, "secret", http.StatusNoContent},
+	}
+	for _, step := range steps {
+		w := do(step.method, step.target, step.body, step.token)
+		if w.Code != step.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.status, w.Code, w.Body.String())
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, want := range []string{
+		"# Team bangs",
+		"# plain search",
+		"# ===== Search =====",
+		"# ===== Development =====",
+		"# keep me",
+		"GitHub Code:",
+		"bang: \"ghc\"",
+		"s: 'g'",
+		"tags: ['code', 'git']",
+		"hidden: true",
+		"icon: 'https://github.githubassets.com/favicon.svg'",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected file to contain %q, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "google.com/favicon.ico") {
+		t.Errorf("expected the icon derived from the URL not to be written, got:\n%s", content)
+	}
+	if strings.Contains(content, "StackOverflow") {
+		t.Errorf("expected StackOverflow to be deleted, got:\n%s", content)
+	}
+
+	if _, ok := registry.Load().Entries.byBang["ghc"]; !ok {
+		t.Errorf("expected edited file to be loaded as active registry")
+	}
+}
+
+func TestEditorHandler_Disabled(t *testing.T) {
+	handler := EditorHandler("bangs.yaml", "", "")
+	req := httptest.NewRequest("DELETE", "/entries/Google", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestRegistryDocument_DeleteKeepsSectionComment(t *testing.T) {
+	d, err := openRegistryDocument([]byte(editorTestRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deleteEntry("Google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.createEntry("Kagi", Entry{Bang: "kagi", URL: "https://kagi.com/search?q={}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# ===== Search =====") {
+		t.Errorf("expected section comment to survive deletion, got:\n%s", data)
+	}
+}
+
+func TestRegistryDocument_RoundTripKeepsFormatting(t *testing.T) {
+	d, err := openRegistryDocument([]byte(editorTestRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != editorTestRegistry {
+		t.Errorf("expected unchanged document to round trip, got:\n%s", data)
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "bangs.yaml")
+	link := filepath.Join(dir, "current.yaml")
+	if err := os.WriteFile(target, []byte("old"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if err := replaceFile(link, []byte("new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected the symlink to stay, got %v, %v", info, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" || info.Mode().Perm() != 0o640 {
+		t.Errorf("expected the target to hold the new content with mode 0640, got %q %v", data, info.Mode())
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Errorf("expected no temporary files to be left, got %v", files)
+	}
+}
+
+func TestEntriesMapping_AgreesWithParse(t *testing.T) {
+	sources := []string{
+		"version: 1\nGoogle:\n  bang: 'g'\n  url: 'https://google.com/?q={}'\n",
+		"version: 2.0\nbangs:\n  Google:\n    bang: 'g'\n    url: 'https://google.com/?q={}'\n",
+		"version:\n  bang: 'v'\n  url: 'https://v.example.com/?q={}'\n",
+		"version: '2'\n",
+		"version: 3\n",
+	}
+	for _, source := range sources {
+		reg, parseErr := Parse([]byte(source), FormatYAML)
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(source), &doc); err != nil {
+			t.Fatal(err)
+		}
+		root := doc.Content[0]
+		entries, err := EntriesMapping(root)
+		if (err != nil) != (parseErr != nil) {
+			t.Errorf("%q: expected EntriesMapping to fail like Parse (%v), got %v", source, parseErr, err)
+			continue
+		}
+		if err == nil && (entries == root) != (reg.Version == 1) {
+			t.Errorf("%q: expected the entries of a version %d file, got the root: %v", source, reg.Version, entries == root)
+		}
+	}
+}
+
+func TestEditorHandler_KeepsFileWatched(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	path := filepath.Join(t.TempDir(), "bangs.yaml")
+	if err := os.WriteFile(path, []byte(editorTestRegistry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan struct{}, 16)
+	go watcher.WatchFile(path, func() error {
+		changed <- struct{}{}
+		return nil
+	})
+	time.Sleep(100 * time.Millisecond)
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-changed:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected the watcher to fire after %s", what)
+		}
+		time.Sleep(200 * time.Millisecond)
+		for len(changed) > 0 {
+			<-changed
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/entries", strings.NewReader(`{"name": "StackOverflow", "bang": "so", "url": "https://stackoverflow.com/search?q={}"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	EditorHandler(path, "", "secret").ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	wait("an edit through the API")
+
+	if err := os.WriteFile(path, []byte(editorTestRegistry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wait("a later write in place")
+}
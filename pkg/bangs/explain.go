@@ -0,0 +1,201 @@
+package bangs
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// explainSuffix, as its own word after a search with a bang, asks for an explanation.
+const explainSuffix = " ?"
+
+// explainsBang reports whether input starts with "!" or a word resolving as a bang or alias.
+func (r *Registry) explainsBang(input string) bool {
+	if strings.HasPrefix(input, "!") {
+		return true
+	}
+	s, err := r.resolve(input, nil)
+	return err == nil && (s.outcome == "bang" || s.outcome == "alias")
+}
+
+// ExplainStep is one decision taken while resolving a query.
+type ExplainStep struct {
+	Step   string `json:"step"`
+	Detail string `json:"detail"`
+}
+
+// ExplainedEntry is an entry a query resolves to and the URL it builds.
+type ExplainedEntry struct {
+	Name        string   `json:"name"`
+	Bang        string   `json:"bang"`
+	Template    QueryURL `json:"template"`
+	URL         string   `json:"url,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+}
+
+// Explanation describes how a query is resolved, with the outcome labels of the search metrics.
+type Explanation struct {
+	Input   string           `json:"input"`
+	Outcome string           `json:"outcome"`
+	Query   string           `json:"query"`
+	Steps   []ExplainStep    `json:"steps"`
+	Entries []ExplainedEntry `json:"entries"`
+	URLs    []string         `json:"urls"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// step records a decision; it does nothing on a nil Explanation.
+func (x *Explanation) step(step, format string, args ...any) {
+	if x == nil {
+		return
+	}
+	x.Steps = append(x.Steps, ExplainStep{Step: step, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (x *Explanation) fail(err error) {
+	x.Outcome = "error"
+	x.Error = err.Error()
+	x.URLs = []string{}
+	x.step("error", "%s", err)
+}
+
+// Explain resolves input like Resolve and records every step on the way.
+func (r *Registry) Explain(input string) Explanation {
+	x := Explanation{Input: input, Steps: []ExplainStep{}, Entries: []ExplainedEntry{}, URLs: []string{}}
+	s, err := r.resolve(input, &x)
+	x.Query = s.query
+	if err != nil {
+		x.fail(err)
+		return x
+	}
+	x.Outcome = s.outcome
+	if s.outcome == "bang" || s.outcome == "alias" {
+		x.step("query", "The query is '%s'", s.query)
+	}
+	if len(s.entries) == 0 {
+		u, err := r.Default.Augment(s.query)
+		if err != nil {
+			x.fail(err)
+			return x
+		}
+		x.URLs = []string{u.String()}
+		x.step("url", "The query '%s' makes %s", s.query, u)
+		return x
+	}
+	r.explainEntries(&x, s.entries, s.query)
+	return x
+}
+
+// explainEntries records the entries a query goes to and, if all can be built, their URLs.
+func (r *Registry) explainEntries(x *Explanation, entries []*Entry, query string) {
+	var failed error
+	for _, entry := range entries {
+		explained := ExplainedEntry{
+			Name:        r.Entries.nameOf(entry.Bang),
+			Bang:        entry.Bang,
+			Template:    entry.URL,
+			Deprecated:  entry.Deprecated,
+			Replacement: entry.Replacement,
+		}
+		x.step("entry", "!%s is the entry '%s' with the URL '%s'", entry.Bang, explained.Name, entry.URL)
+		u, err := entry.URL.Augment(query)
+		if err != nil {
+			explained.Error = err.Error()
+			failed = err
+		} else {
+			explained.URL = u.String()
+			x.URLs = append(x.URLs, explained.URL)
+			x.step("url", "The query '%s' makes %s", query, u)
+		}
+		if entry.Deprecated {
+			x.step("deprecated", "!%s is deprecated, a notice is shown before redirecting", entry.Bang)
+		}
+		x.Entries = append(x.Entries, explained)
+	}
+	if failed != nil {
+		x.fail(failed)
+		return
+	}
+	if len(x.URLs) > 1 {
+		x.step("tabs", "The browser opens %d tabs", len(x.URLs))
+	}
+}
+
+// nameOf returns the name of the entry with bang, or "" if there is none.
+func (bl BangList) nameOf(bang string) string {
+	for name, entry := range bl.Entries {
+		if entry.Bang == bang || slices.Contains(entry.Aliases, bang) {
+			return name
+		}
+	}
+	return ""
+}
+
+var explainPage = template.Must(template.New("explain").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Explain {{.Input}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; }
+code { background: #f0f0f0; padding: 0 .2rem; }
+table { border-collapse: collapse; }
+td, th { text-align: left; padding: .2rem .6rem; border-bottom: 1px solid #ddd; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Explaining <code>{{.Input}}</code></h1>
+<p>Outcome: <strong>{{.Outcome}}</strong>{{if .Query}}, query <code>{{.Query}}</code>{{end}}</p>
+{{if .Error}}<p class="error">Error: {{.Error}}</p>{{end}}
+<h2>Steps</h2>
+<ol>
+{{range .Steps}}<li><code>{{.Step}}</code> {{.Detail}}</li>
+{{end}}</ol>
+{{if .Entries}}<h2>Entries</h2>
+<table>
+<tr><th>Name</th><th>Bang</th><th>URL template</th><th>URL</th></tr>
+{{range .Entries}}<tr><td>{{.Name}}{{if .Deprecated}} (deprecated{{if .Replacement}}, use !{{.Replacement}}{{end}}){{end}}</td><td>!{{.Bang}}</td><td><code>{{.Template}}</code></td><td>{{if .URL}}<a href="{{.URL}}" rel="noreferrer">{{.URL}}</a>{{else}}<span class="error">{{.Error}}</span>{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{if .URLs}}<h2>URLs</h2>
+<ul>
+{{range .URLs}}<li><a href="{{.}}" rel="noreferrer">{{.}}</a></li>
+{{end}}</ul>
+{{end}}<p><a href="{{.JSONLink}}">As JSON</a></p>
+</body>
+</html>
+`))
+
+// explain answers /explain?q= with how the query is resolved, as HTML or JSON.
+func explain(w http.ResponseWriter, r *http.Request) {
+	writeExplanation(w, r, r.URL.Query().Get("q"))
+}
+
+func writeExplanation(w http.ResponseWriter, r *http.Request, input string) {
+	reg := RequestRegistry(r)
+	if reg == nil {
+		http.Error(w, "No registry loaded", http.StatusServiceUnavailable)
+		return
+	}
+	x := reg.Explain(input)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, x)
+		return
+	}
+	query := r.URL.Query()
+	query.Set("format", "json")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := explainPage.Execute(w, struct {
+		Explanation
+		JSONLink string
+	}{x, "?" + query.Encode()})
+	if err != nil {
+		slog.Error("Error writing explanation", "err", err)
+	}
+}
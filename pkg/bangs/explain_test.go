@@ -0,0 +1,151 @@
+package bangs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Explain(t *testing.T) {
+	reg, err := Parse([]byte(`
+default: 'search'
+aliases:
+  search: 'g+w'
+  shop: 'amz'
+  both: 'g+nope'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+Wikipedia:
+  bang: 'w'
+  url: 'https://en.wikipedia.org/wiki/Special:Search?search={}'
+Amazon:
+  bang: 'amz'
+  url: 'https://www.amazon.com/s?k={}'
+  deprecated: true
+Broken:
+  bang: 'broken'
+  url: 'https://example.com/'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		allowNoBang bool
+		input       string
+		outcome     string
+		steps       []string
+	}{
+		{false, "!g red shoes", "bang", []string{"bang", "query", "entry", "url"}},
+		{false, "!shop red shoes", "alias", []string{"bang", "alias", "query", "entry", "url", "deprecated"}},
+		{false, "!g+w red", "bang", []string{"bang", "multi_bang", "query", "entry", "url", "entry", "url", "tabs"}},
+		{false, "##!g red", "default", []string{"double_hash", "default", "alias", "entry", "url", "entry", "url", "tabs"}},
+		{false, ".!g red", "ignore", []string{"ignore_char", "default", "alias", "entry", "url", "entry", "url", "tabs"}},
+		{false, "red shoes", "default", []string{"bang", "default", "alias", "entry", "url", "entry", "url", "tabs"}},
+		{true, "!x red", "default", []string{"bang", "default", "default", "alias", "entry", "url", "entry", "url", "tabs"}},
+		{false, "!x red", "error", []string{"bang", "error"}},
+		{false, "!both red", "error", []string{"bang", "alias", "multi_bang", "error"}},
+		{false, "!broken red", "error", []string{"bang", "query", "entry", "error"}},
+		{false, " ", "error", []string{"error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			SetOptions(tt.allowNoBang, false, ".")
+			defer SetOptions(false, false, ".")
+
+			x := reg.Explain(tt.input)
+			if x.Outcome != tt.outcome {
+				t.Errorf("expected outcome %s, got %s (%v)", tt.outcome, x.Outcome, x.Steps)
+			}
+			steps := make([]string, len(x.Steps))
+			for i, step := range x.Steps {
+				steps[i] = step.Step
+			}
+			if !slices.Equal(steps, tt.steps) {
+				t.Errorf("expected steps %v, got %v", tt.steps, steps)
+			}
+
+			urls, err := reg.Resolve(tt.input)
+			if (err != nil) != (x.Error != "") {
+				t.Errorf("expected the same error as Resolve, got %q and %v", x.Error, err)
+			}
+			if len(urls) > 0 && !slices.Equal(urls, x.URLs) {
+				t.Errorf("expected the URLs of Resolve %v, got %v", urls, x.URLs)
+			}
+		})
+	}
+
+	x := reg.Explain("!shop red shoes")
+	if len(x.Entries) != 1 || x.Entries[0].Name != "Amazon" || !x.Entries[0].Deprecated || x.Query != "red shoes" {
+		t.Errorf("expected the deprecated Amazon entry for 'red shoes', got %+v", x)
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	reg, err := Parse([]byte(`
+default: 'https://duckduckgo.com/?q={}'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+	handler := Handler(false, false, ".")
+	serve := func(target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/explain?q="+url.QueryEscape("!g <b>shoes</b>"), nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML page, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "<b>shoes</b>") || !strings.Contains(body, "&lt;b&gt;shoes&lt;/b&gt;") {
+		t.Errorf("expected the query to be escaped, got %s", body)
+	}
+	if !strings.Contains(body, "https://www.google.com/search?q=%3Cb%3Eshoes%3C%2Fb%3E") {
+		t.Errorf("expected the final URL on the page, got %s", body)
+	}
+
+	for _, tt := range []struct {
+		target string
+		header http.Header
+	}{
+		{"/explain?format=json&q=" + url.QueryEscape("!g shoes"), nil},
+		{"/explain?q=" + url.QueryEscape("!g shoes"), http.Header{"Accept": {"application/json"}}},
+		{"/?format=json&q=" + url.QueryEscape("!g shoes ?"), nil},
+	} {
+		w := serve(tt.target, tt.header)
+		var x Explanation
+		if err := json.Unmarshal(w.Body.Bytes(), &x); err != nil {
+			t.Fatalf("%s: expected JSON, got %d %s", tt.target, w.Code, w.Body)
+		}
+		if x.Input != "!g shoes" || len(x.URLs) != 1 || x.URLs[0] != "https://www.google.com/search?q=shoes" {
+			t.Errorf("%s: expected the explanation of '!g shoes', got %+v", tt.target, x)
+		}
+	}
+
+	if w := serve("/?q="+url.QueryEscape("!g what?"), nil); w.Code != http.StatusFound {
+		t.Errorf("expected a question mark on the last word to be searched, got %d", w.Code)
+	}
+	w = serve("/?q="+url.QueryEscape("quoi de neuf ?"), nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://duckduckgo.com/?q=quoi+de+neuf+%3F" {
+		t.Errorf("expected a spaced question mark without a bang to be searched, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,222 @@
+package bangs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the file format of a registry file.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// ParseFormat validates a format name; an empty name means detecting it from the extension.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case "", FormatYAML, FormatJSON, FormatTOML:
+		return f, nil
+	case "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unknown registry format '%s' (expected yaml, json or toml)", name)
+}
+
+// FormatFromPath picks the registry format by file extension, falling back to YAML.
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatYAML
+}
+
+// decodeRaw decodes a registry file into the map that registryFromMap validates.
+func decodeRaw(data []byte, format Format) (map[string]any, error) {
+	raw := make(map[string]any)
+	var err error
+	switch format {
+	case FormatYAML, "":
+		err = yaml.Unmarshal(data, &raw)
+	case FormatJSON:
+		err = json.Unmarshal(data, &raw)
+	case FormatTOML:
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unknown registry format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Parse decodes and validates a registry in the given format.
+func Parse(data []byte, format Format) (*Registry, error) {
+	raw, err := decodeRaw(data, format)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := registryFromMap(raw)
+	if err != nil {
+		return nil, err
+	}
+	reg.Entries.setOrder(declarationOrder(data, format, reg.Version))
+	reg.completions = newCompletionIndex(reg)
+	return reg, nil
+}
+
+// LatestVersion is the newest registry format; version 2 keeps entries in a bangs map.
+const LatestVersion = 2
+
+// registryVersion reads the version key of a decoded registry, 1 if it has none.
+func registryVersion(raw map[string]any) (int, error) {
+	v, ok := raw["version"]
+	if !ok {
+		return 1, nil
+	}
+	return versionValue(v)
+}
+
+// documentVersion is registryVersion for the root mapping of a YAML document.
+func documentVersion(root *yaml.Node) (int, error) {
+	i := mappingIndex(root, "version")
+	if i < 0 {
+		return 1, nil
+	}
+	var v any
+	if err := root.Content[i+1].Decode(&v); err != nil {
+		return 0, fmt.Errorf("version: %w", err)
+	}
+	return versionValue(v)
+}
+
+// versionValue checks the decoded value of a version key.
+func versionValue(v any) (int, error) {
+	var version int
+	switch n := v.(type) {
+	case map[string]any:
+		return 1, nil
+	case int:
+		version = n
+	case int64:
+		version = int(n)
+	case uint64:
+		version = int(n)
+	case float64:
+		version = int(n)
+		if float64(version) != n {
+			return 0, fmt.Errorf("version must be an integer")
+		}
+	default:
+		return 0, fmt.Errorf("version must be an integer")
+	}
+	if version < 1 || version > LatestVersion {
+		return 0, fmt.Errorf("unsupported registry version %d (supported: 1 to %d)", version, LatestVersion)
+	}
+	return version, nil
+}
+
+func registryFromMap(raw map[string]any) (*Registry, error) {
+	var reg Registry
+
+	version, err := registryVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	reg.Version = version
+
+	var entries map[string]any
+	if version == 1 {
+		entries = make(map[string]any, len(raw))
+		for k, v := range raw {
+			entries[k] = v
+		}
+		delete(entries, "default")
+		delete(entries, "aliases")
+		if v, ok := raw["version"]; ok {
+			if _, isEntry := v.(map[string]any); !isEntry {
+				delete(entries, "version")
+			}
+		}
+	} else {
+		for k := range raw {
+			switch k {
+			case "version", "default", "aliases", "bangs":
+			default:
+				return nil, fmt.Errorf("unknown top-level key '%s' in version %d registry, entries belong under 'bangs'", k, version)
+			}
+		}
+		if b, ok := raw["bangs"]; ok {
+			entries, ok = b.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("bangs must be a map of entry name to entry")
+			}
+		}
+		for name, e := range entries {
+			if _, ok := e.(map[string]any); !ok {
+				return nil, fmt.Errorf("entry '%s' must be a map", name)
+			}
+		}
+	}
+
+	if d, ok := raw["default"]; ok {
+		defaultStr, ok := d.(string)
+		if !ok {
+			return nil, fmt.Errorf("default must be a string")
+		}
+		defaultStr, err := interpolate(defaultStr)
+		if err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+		reg.Default = QueryURL(defaultStr)
+	}
+
+	if a, ok := raw["aliases"]; ok {
+		aliasMap, ok := a.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("aliases must be a map of alias to bangs")
+		}
+		reg.Aliases = make(map[string]string, len(aliasMap))
+		for alias, target := range aliasMap {
+			if m, ok := target.(map[string]any); ok {
+				target = m["target"]
+				if t, ok := m["tests"]; ok {
+					tests, err := readTests(t, alias)
+					if err != nil {
+						return nil, err
+					}
+					if reg.AliasTests == nil {
+						reg.AliasTests = make(map[string][]TestCase)
+					}
+					reg.AliasTests[alias] = tests
+				}
+			}
+			targetStr, ok := target.(string)
+			if !ok {
+				return nil, fmt.Errorf("target of alias '%s' must be a string", alias)
+			}
+			targetStr, err := interpolate(targetStr)
+			if err != nil {
+				return nil, fmt.Errorf("alias '%s': %w", alias, err)
+			}
+			reg.Aliases[alias] = targetStr
+		}
+	}
+
+	err = reg.Entries.fromEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
@@ -1,7 +1,6 @@
 package bangs
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -9,39 +8,37 @@ import (
 	"strings"
 
 	"github.com/dikkadev/bangs/pkg/middleware"
-
-	"github.com/dikkadev/prettyslog"
 )
 
 func Handler(doAllowNoBang bool, doAllowMultiBang bool, ignoreCharPar string) http.Handler {
-	allowNoBang = doAllowNoBang
-	ignoreChar = ignoreCharPar
-	allowMultiBang = doAllowMultiBang
+	SetOptions(doAllowNoBang, doAllowMultiBang, ignoreCharPar)
 
 	router := http.NewServeMux()
 
 	router.HandleFunc("/list", listAll)
+	router.HandleFunc("/explain", explain)
 	router.HandleFunc("/", searchByQuery)
 
-	logOptions := make([]prettyslog.Option, 0)
-	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
-		logOptions = append(logOptions, prettyslog.WithLevel(slog.LevelDebug))
-	}
-	logger := slog.New(prettyslog.NewPrettyslogHandler("HTTP", logOptions...))
+	logger := middleware.NewLogger("HTTP")
 	stack := middleware.CreateStack(
 		middleware.Logger(logger, "bang"),
+		middleware.RequestMetrics(searchRequests, searchDuration),
 	)
 
 	return stack(router)
 }
 
 func listAll(w http.ResponseWriter, r *http.Request) {
+	reg := RequestRegistry(r)
+	// entries holds the same entries as bangs, in the order of the registry file.
 	response := struct {
 		Bangs   map[string]Entry  `json:"bangs"`
+		Entries []NamedEntry      `json:"entries"`
 		Aliases map[string]string `json:"aliases"`
 	}{
-		Bangs:   All().Entries,
-		Aliases: registry.Aliases,
+		Bangs:   reg.listedBangs(),
+		Entries: reg.listedEntries(),
+		Aliases: reg.Aliases,
 	}
 
 	asJSON, err := json.Marshal(response)
@@ -59,45 +56,45 @@ func listAll(w http.ResponseWriter, r *http.Request) {
 }
 
 func searchByQuery(w http.ResponseWriter, r *http.Request) {
+	reg := RequestRegistry(r)
 	queries := r.URL.Query()
 	q := queries.Get("q")
 	if strings.TrimSpace(q) == "" {
 		msg := "No query provided for search"
 		slog.Error(msg, "url", r.URL)
 		http.Error(w, msg, http.StatusBadRequest)
+		observeSearch(r, search{}, fmt.Errorf("%s", msg), "no_query")
 		return
 	}
 
-	if strings.HasPrefix(q, "##") {
-		slog.Debug("Double hashtag found, forwarding to default", "query", q)
-		q = strings.TrimPrefix(q, "##")
-		_ = registry.DefaultForward(q, w, r)
-		return
-	}
-
-	entries, query, err := registry.Entries.PrepareInput(q)
-	if len(entries) > 1 {
-		generateMultiTabHTML(entries, query, w)
+	if input, ok := strings.CutSuffix(q, explainSuffix); ok && reg.explainsBang(input) {
+		writeExplanation(w, r, input)
 		return
 	}
 
+	s, err := reg.resolve(q, nil)
 	if err != nil {
-		if _, ok := err.(InputHasNoBangError); ok {
-			slog.Debug("No bang found in input, forwarding to default", "query", q)
-			_ = registry.DefaultForward(q, w, r)
+		if s.outcome != "" {
+			msg := err.Error()
+			http.Error(w, strings.ToUpper(msg[:1])+msg[1:], http.StatusInternalServerError)
+			observeSearch(r, s, err, "default")
 			return
 		}
-		if _, ok := err.(InputStartsWithIgnoreError); ok {
-			slog.Debug("Input starts with ignore character, removing ingoreChar and forwarding to default", "query", q)
-			q = q[1:]
-			_ = registry.DefaultForward(q, w, r)
-			return
-		}
-
 		slog.Error("Error preparing input", "err", err)
 		http.Error(w, fmt.Sprintf("Error preparing input: %v", err), http.StatusBadRequest)
+		observeSearch(r, s, err, "invalid_input")
 		return
 	}
-	entry := entries[0]
-	_ = entry.Forward(query, w, r)
+
+	errType := "invalid_url"
+	switch s.outcome {
+	case "default":
+		slog.Debug("No bang found in input, forwarding to default", "query", middleware.RedactQuery(q))
+		errType = "default"
+	case "ignore":
+		slog.Debug("Input starts with ignore character, forwarding the rest to default", "query", middleware.RedactQuery(q))
+		errType = "default"
+	}
+	err = reg.forward(s, w, r)
+	observeSearch(r, s, err, errType)
 }
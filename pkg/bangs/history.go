@@ -0,0 +1,390 @@
+package bangs
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is one resolved search of User, without query and URLs in private mode.
+type HistoryEntry struct {
+	ID    int64     `json:"id"`
+	Time  time.Time `json:"time"`
+	User  string    `json:"user,omitempty"`
+	Bang  string    `json:"bang,omitempty"`
+	Query string    `json:"query,omitempty"`
+	URLs  []string  `json:"urls,omitempty"`
+}
+
+// matches reports whether the lower-case text occurs in the bang, query or URLs of e.
+func (e HistoryEntry) matches(text string) bool {
+	if strings.Contains(strings.ToLower(e.Bang), text) || strings.Contains(strings.ToLower(e.Query), text) {
+		return true
+	}
+	for _, u := range e.URLs {
+		if strings.Contains(strings.ToLower(u), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// History keeps the latest resolved searches in a local file with one JSON object per line.
+type History struct {
+	mu      sync.Mutex
+	path    string
+	limit   int
+	private bool
+	entries []HistoryEntry
+	// counts holds the number of entries per user.
+	counts map[string]int
+	nextID int64
+	// lines counts the entries in the file, compacted once it holds twice as many as are kept.
+	lines int
+}
+
+// history records searches when the search history is enabled, see SetHistory.
+var history *History
+
+// SetHistory makes resolved searches be recorded in h; a nil h disables the history.
+func SetHistory(h *History) {
+	history = h
+}
+
+// OpenHistory reads the history file at path, keeping at most limit entries per user.
+func OpenHistory(path string, limit int, private bool) (*History, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("history limit must be at least 1, got %d", limit)
+	}
+	h := &History{path: path, limit: limit, private: private, counts: make(map[string]int), nextID: 1}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scrubbed := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("reading history file %s line %d: %w", path, n, err)
+		}
+		if private && (entry.Query != "" || len(entry.URLs) > 0) {
+			entry.Query, entry.URLs = "", nil
+			scrubbed = true
+		}
+		h.entries = append(h.entries, entry)
+		h.nextID = max(h.nextID, entry.ID+1)
+		h.lines++
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history file %s: %w", path, err)
+	}
+	kept := make([]HistoryEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if user := h.entries[i].User; h.counts[user] < limit {
+			h.counts[user]++
+			kept = append(kept, h.entries[i])
+		}
+	}
+	slices.Reverse(kept)
+	h.entries = kept
+	if scrubbed || h.lines > len(h.entries) {
+		err = h.rewrite()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Private reports whether query text is left out of the history.
+func (h *History) Private() bool {
+	return h.private
+}
+
+// Record adds a search, dropping the oldest entry of the same user once the limit is reached.
+func (h *History) Record(e HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.ID = h.nextID
+	h.nextID++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if h.private {
+		e.Query, e.URLs = "", nil
+	}
+	h.entries = append(h.entries, e)
+	h.counts[e.User]++
+	if h.counts[e.User] > h.limit {
+		i := slices.IndexFunc(h.entries, func(old HistoryEntry) bool {
+			return old.User == e.User
+		})
+		h.entries = slices.Delete(h.entries, i, i+1)
+		h.counts[e.User]--
+	}
+	if h.lines >= 2*max(h.limit, len(h.entries)) {
+		return h.rewrite()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	h.lines++
+	return nil
+}
+
+// Entries returns at most limit entries of user matching text, newest first.
+func (h *History) Entries(user, text string, limit int) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	text = strings.ToLower(strings.TrimSpace(text))
+	found := make([]HistoryEntry, 0)
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(found) == limit {
+			break
+		}
+		if h.entries[i].User == user && (text == "" || h.entries[i].matches(text)) {
+			found = append(found, h.entries[i])
+		}
+	}
+	return found
+}
+
+// Delete removes the entry of user with the given ID and reports whether it existed.
+func (h *History) Delete(user string, id int64) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, entry := range h.entries {
+		if entry.ID == id && entry.User == user {
+			h.entries = append(h.entries[:i:i], h.entries[i+1:]...)
+			h.counts[user]--
+			return true, h.rewrite()
+		}
+	}
+	return false, nil
+}
+
+// Purge removes all entries of user from the history and its file.
+func (h *History) Purge(user string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = slices.DeleteFunc(h.entries, func(e HistoryEntry) bool {
+		return e.User == user
+	})
+	delete(h.counts, user)
+	return h.rewrite()
+}
+
+// PurgeAll removes the entries of every user from the history and its file.
+func (h *History) PurgeAll() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+	clear(h.counts)
+	return h.rewrite()
+}
+
+// rewrite replaces the history file with the current entries; the caller must hold h.mu or own h.
+func (h *History) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), "."+filepath.Base(h.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, entry := range h.entries {
+		if err = enc.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), h.path)
+	if err != nil {
+		return err
+	}
+	h.lines = len(h.entries)
+	return nil
+}
+
+// historyEntry describes the resolved search s.
+func (r *Registry) historyEntry(s search) HistoryEntry {
+	entry := HistoryEntry{Time: time.Now(), Bang: s.bang, Query: s.query}
+	entry.URLs, _ = r.urls(s)
+	return entry
+}
+
+// WriteHistoryCSV writes entries as CSV with a header row.
+func WriteHistoryCSV(w io.Writer, entries []HistoryEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "bang", "query", "urls"})
+	for _, entry := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.Time.Format(time.RFC3339),
+			entry.Bang,
+			entry.Query,
+			strings.Join(entry.URLs, " "),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// HistoryHandler serves the history of the logged in user, or of searches without one to the admin.
+func HistoryHandler(token string, proxied bool) http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /history", listHistory)
+	router.HandleFunc("DELETE /history", purgeHistory)
+	router.HandleFunc("DELETE /history/{id}", deleteHistoryEntry)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if history == nil {
+			http.Error(w, "Search history is disabled, set a history file to enable it", http.StatusNotFound)
+			return
+		}
+		switch {
+		case RequestUser(r) != "":
+		case token != "":
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bangs"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		// Behind a proxy every client may look local.
+		case proxied || isForwarded(r):
+			http.Error(w, "Search history behind a proxy needs an admin token", http.StatusForbidden)
+			return
+		case !isLoopback(r.RemoteAddr):
+			http.Error(w, "Search history is only available locally, set an admin token to access it remotely", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		router.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback reports whether a remote address is on the loopback interface or a Unix socket.
+func isLoopback(remoteAddr string) bool {
+	if remoteAddr == "" || remoteAddr == "@" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isForwarded reports whether a request came through a proxy that says so.
+func isForwarded(r *http.Request) bool {
+	return r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "" || r.Header.Get("Forwarded") != ""
+}
+
+func listHistory(w http.ResponseWriter, r *http.Request) {
+	h := history
+	queries := r.URL.Query()
+	limit := 0
+	if l := queries.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit '%s'", l), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	entries := h.Entries(RequestUser(r), queries.Get("q"), limit)
+
+	switch format := queries.Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, struct {
+			Private bool           `json:"private"`
+			Entries []HistoryEntry `json:"entries"`
+		}{h.Private(), entries})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="bangs-history.csv"`)
+		WriteHistoryCSV(w, entries)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown format '%s', use json or csv", format), http.StatusBadRequest)
+	}
+}
+
+func deleteHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid history entry '%s'", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+	found, err := history.Delete(RequestUser(r), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error deleting history entry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("History entry %d not found", id), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func purgeHistory(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if user := RequestUser(r); user != "" {
+		err = history.Purge(user)
+	} else {
+		err = history.PurgeAll()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error purging history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,285 @@
+package bangs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistory_RecordAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(path, 3, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, q := range []string{"one", "two", "three", "four", "five", "six", "seven"} {
+		if err := h.Record(HistoryEntry{Bang: "g", Query: q}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	got := h.Entries("", "", 0)
+	if len(got) != 3 || got[0].Query != "seven" || got[2].Query != "five" || got[0].ID != 7 {
+		t.Errorf("expected the last three searches newest first, got %+v", got)
+	}
+	if h.lines > 6 {
+		t.Errorf("expected the file to be compacted at twice the limit, it has %d lines", h.lines)
+	}
+
+	reopened, err := OpenHistory(path, 3, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := reopened.Entries("", "", 0); len(got) != 3 || got[0].Query != "seven" {
+		t.Errorf("expected the history to survive a restart, got %+v", got)
+	}
+	reopened.Record(HistoryEntry{Query: "eight"})
+	if got := reopened.Entries("", "", 1); len(got) != 1 || got[0].ID != 8 {
+		t.Errorf("expected IDs to continue after a restart, got %+v", got)
+	}
+
+	found, err := reopened.Delete("", 6)
+	if err != nil || !found {
+		t.Fatalf("expected entry 6 to be deleted, got %v, %v", found, err)
+	}
+	if found, _ := reopened.Delete("", 6); found {
+		t.Errorf("expected deleting a missing entry to report it")
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), `"six"`) {
+		t.Errorf("expected deleted entries to be removed from the file, got %s", data)
+	}
+
+	if err := reopened.Purge(""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("expected an empty file after purging, got %s", data)
+	}
+
+	os.WriteFile(path, []byte("{\n"), 0o600)
+	if _, err := OpenHistory(path, 3, false); err == nil {
+		t.Errorf("expected an error for a broken history file")
+	}
+	if _, err := OpenHistory(path, 0, false); err == nil {
+		t.Errorf("expected an error for a limit below 1")
+	}
+}
+
+func TestHistory_Private(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(path, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Record(HistoryEntry{Bang: "g", Query: "secret", URLs: []string{"https://www.google.com/search?q=secret"}})
+
+	private, err := OpenHistory(path, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private.Record(HistoryEntry{Bang: "gh", Query: "also secret", URLs: []string{"https://github.com/search?q=also+secret"}})
+	got := private.Entries("", "", 0)
+	if len(got) != 2 || got[0].Bang != "gh" || got[1].Bang != "g" {
+		t.Errorf("expected both bangs to be kept, got %+v", got)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("expected no query text in the file in private mode, got %s", data)
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	defer SetHistory(nil)
+	SetOptions(false, true, ".")
+	defer SetOptions(false, false, ".")
+
+	reg, err := Parse([]byte(`
+default: 'https://duckduckgo.com/?q={}'
+aliases:
+  code: 'gh'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+
+	local := func(method, target string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = "127.0.0.1:4321"
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, local("GET", "/history"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 while the history is disabled, got %d", w.Code)
+	}
+
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetHistory(h)
+	handler := Handler(false, true, ".")
+	for _, q := range []string{"!gh bangs", "!code golang", "##plain search", ".ignored", "!g+gh both", "!unknown x"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q="+url.QueryEscape(q), nil))
+	}
+
+	want := []HistoryEntry{
+		{Bang: "g+gh", Query: "both", URLs: []string{"https://www.google.com/search?q=both", "https://github.com/search?q=both"}},
+		{Query: "ignored", URLs: []string{"https://duckduckgo.com/?q=ignored"}},
+		{Query: "plain search", URLs: []string{"https://duckduckgo.com/?q=plain+search"}},
+		{Bang: "code", Query: "golang", URLs: []string{"https://github.com/search?q=golang"}},
+		{Bang: "gh", Query: "bangs", URLs: []string{"https://github.com/search?q=bangs"}},
+	}
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, local("GET", "/history"))
+	var list struct {
+		Private bool           `json:"private"`
+		Entries []HistoryEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unexpected response %d %s: %v", w.Code, w.Body, err)
+	}
+	if len(list.Entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), list.Entries)
+	}
+	for i, entry := range list.Entries {
+		if entry.Bang != want[i].Bang || entry.Query != want[i].Query || strings.Join(entry.URLs, " ") != strings.Join(want[i].URLs, " ") {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, local("GET", "/history?q=GITHUB&format=csv"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || len(lines) != 4 || lines[0] != "id,time,bang,query,urls" {
+		t.Errorf("expected a CSV export of the three GitHub searches, got %q", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, local("DELETE", "/history/1"))
+	if w.Code != http.StatusNoContent || len(h.Entries("", "bangs", 0)) != 0 {
+		t.Errorf("expected entry 1 to be deleted, got %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, local("DELETE", "/history/1"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted entry, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, httptest.NewRequest("GET", "/history", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected remote clients to be rejected without a token, got %d", w.Code)
+	}
+	r := local("GET", "/history")
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	w = httptest.NewRecorder()
+	HistoryHandler("", false).ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected forwarded requests to be rejected without a token, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HistoryHandler("", true).ServeHTTP(w, local("GET", "/history"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected local requests behind trusted proxies to be rejected without a token, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HistoryHandler("secret", false).ServeHTTP(w, local("DELETE", "/history"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected requests without the token to be rejected, got %d", w.Code)
+	}
+	r = httptest.NewRequest("DELETE", "/history", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	HistoryHandler("secret", false).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || len(h.Entries("", "", 0)) != 0 {
+		t.Errorf("expected the history to be purged, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestHistory_PerUser(t *testing.T) {
+	h, err := OpenHistory(filepath.Join(t.TempDir(), "history.jsonl"), 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetHistory(nil)
+	SetHistory(h)
+	h.Record(HistoryEntry{Bang: "g", Query: "shared"})
+	h.Record(HistoryEntry{User: "alice", Bang: "g", Query: "alice's"})
+	h.Record(HistoryEntry{User: "bob", Bang: "g", Query: "bob's"})
+
+	as := func(user, method, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		w := httptest.NewRecorder()
+		HistoryHandler("secret", true).ServeHTTP(w, r)
+		return w
+	}
+	w := as("alice", "GET", "/history")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alice's") || strings.Contains(w.Body.String(), "shared") || strings.Contains(w.Body.String(), "bob's") {
+		t.Errorf("expected alice to see only their own searches without a token, got %d %s", w.Code, w.Body)
+	}
+	if w := as("alice", "DELETE", "/history/3"); w.Code != http.StatusNotFound {
+		t.Errorf("expected alice not to delete bob's search, got %d", w.Code)
+	}
+	if w := as("alice", "DELETE", "/history"); w.Code != http.StatusNoContent {
+		t.Errorf("expected alice to clear their history, got %d", w.Code)
+	}
+	if got := h.Entries("", "", 0); len(got) != 1 || got[0].Query != "shared" {
+		t.Errorf("expected the shared search to stay, got %+v", got)
+	}
+	if got := h.Entries("bob", "", 0); len(got) != 1 {
+		t.Errorf("expected bob's search to stay, got %+v", got)
+	}
+
+	r := httptest.NewRequest("DELETE", "/history", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	HistoryHandler("secret", true).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || len(h.Entries("", "", 0)) != 0 || len(h.Entries("bob", "", 0)) != 0 {
+		t.Errorf("expected the admin to clear every user's history, got %d", w.Code)
+	}
+}
+
+func TestHistory_LimitPerUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(path, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Record(HistoryEntry{User: "bob", Query: "bob's"})
+	for _, q := range []string{"one", "two", "three", "four", "five"} {
+		h.Record(HistoryEntry{User: "alice", Query: q})
+	}
+	check := func(h *History) {
+		t.Helper()
+		if got := h.Entries("bob", "", 0); len(got) != 1 {
+			t.Errorf("expected alice's searches not to evict bob's, got %+v", got)
+		}
+		if got := h.Entries("alice", "", 0); len(got) != 2 || got[0].Query != "five" || got[1].Query != "four" {
+			t.Errorf("expected alice's last two searches, got %+v", got)
+		}
+	}
+	check(h)
+	reopened, err := OpenHistory(path, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+}
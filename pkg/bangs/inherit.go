@@ -0,0 +1,80 @@
+package bangs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// inheritedFields are the fields an entry takes from its parent unless set; bangs never are.
+var inheritedFields = []string{"url", "description", "category", "tags", "icon", "examples"}
+
+// resolveExtends applies extends: to the decoded entries and drops the templates.
+func resolveExtends(tempMap map[string]any) (map[string]any, error) {
+	resolved := make(map[string]map[string]any, len(tempMap))
+
+	var resolve func(name string, chain []string) (map[string]any, error)
+	resolve = func(name string, chain []string) (map[string]any, error) {
+		if r, ok := resolved[name]; ok {
+			return r, nil
+		}
+		for i, n := range chain {
+			if n == name {
+				return nil, fmt.Errorf("inheritance cycle: %s", strings.Join(append(chain[i:], name), " -> "))
+			}
+		}
+		v := tempMap[name].(map[string]any)
+		p, ok := v["extends"]
+		if !ok {
+			resolved[name] = v
+			return v, nil
+		}
+		parentName, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("field 'extends' of entry '%s' must be a string", name)
+		}
+		if _, isEntry := tempMap[parentName].(map[string]any); !isEntry {
+			return nil, fmt.Errorf("entry '%s' extends unknown entry '%s'", name, parentName)
+		}
+		parent, err := resolve(parentName, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		merged := make(map[string]any, len(v)+len(inheritedFields))
+		for k, value := range v {
+			merged[k] = value
+		}
+		for _, field := range inheritedFields {
+			if _, ok := merged[field]; !ok {
+				if value, ok := parent[field]; ok {
+					merged[field] = value
+				}
+			}
+		}
+		resolved[name] = merged
+		return merged, nil
+	}
+
+	entries := make(map[string]any, len(tempMap))
+	for name, a := range tempMap {
+		v, ok := a.(map[string]any)
+		if !ok {
+			entries[name] = a
+			continue
+		}
+		template := false
+		if t, ok := v["template"]; ok {
+			template, ok = t.(bool)
+			if !ok {
+				return nil, fmt.Errorf("field 'template' of entry '%s' must be true or false", name)
+			}
+		}
+		r, err := resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !template {
+			entries[name] = r
+		}
+	}
+	return entries, nil
+}
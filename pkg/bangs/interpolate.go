@@ -0,0 +1,66 @@
+package bangs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// interpolate resolves ${ENV_VAR} and ${file:/path} references; "$${" is a literal "${".
+func interpolate(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var out strings.Builder
+	rest := value
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			out.WriteString(rest)
+			return out.String(), nil
+		}
+		if start > 0 && rest[start-1] == '$' {
+			out.WriteString(rest[:start-1])
+			out.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+		out.WriteString(rest[:start])
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated '${' in '%s'", value)
+		}
+		ref := rest[start+2 : start+end]
+		rest = rest[start+end+1:]
+
+		resolved, err := resolveReference(ref)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(resolved)
+	}
+}
+
+func resolveReference(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		if path == "" {
+			return "", fmt.Errorf("empty file path in '${%s}'", ref)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if ref == "" {
+		return "", fmt.Errorf("empty variable name in '${}'")
+	}
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("undefined environment variable '%s'", ref)
+	}
+	return value, nil
+}
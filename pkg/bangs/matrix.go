@@ -0,0 +1,131 @@
+package bangs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// expandMatrix replaces every matrix entry by one entry per combination, returning the generated names.
+func expandMatrix(tempMap map[string]any) (map[string]any, map[string][]string, error) {
+	entries := make(map[string]any, len(tempMap))
+	expanded := make(map[string][]string)
+
+	var generators []string
+	for name, a := range tempMap {
+		v, ok := a.(map[string]any)
+		if !ok {
+			entries[name] = a
+			continue
+		}
+		if _, ok := v["matrix"]; ok {
+			generators = append(generators, name)
+			continue
+		}
+		entries[name] = a
+	}
+	sort.Strings(generators)
+
+	for _, name := range generators {
+		v := tempMap[name].(map[string]any)
+		combinations, err := matrixCombinations(name, v["matrix"])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, vars := range combinations {
+			generatedName := substituteVars(name, vars).(string)
+			if generatedName == name {
+				values := make([]string, 0, len(vars))
+				for _, key := range sortedKeys(vars) {
+					values = append(values, vars[key])
+				}
+				generatedName = fmt.Sprintf("%s (%s)", name, strings.Join(values, ", "))
+			}
+			if _, ok := entries[generatedName]; ok {
+				return nil, nil, fmt.Errorf("entry '%s' generated by the matrix of '%s' already exists", generatedName, name)
+			}
+
+			generated := make(map[string]any, len(v))
+			for k, value := range v {
+				if k != "matrix" {
+					generated[k] = substituteVars(value, vars)
+				}
+			}
+			entries[generatedName] = generated
+			expanded[name] = append(expanded[name], generatedName)
+		}
+	}
+	return entries, expanded, nil
+}
+
+// maxMatrixCombinations limits the entries a single matrix generates.
+const maxMatrixCombinations = 1000
+
+// matrixCombinations returns every combination of the matrix values, the first variable changing slowest.
+func matrixCombinations(name string, m any) ([]map[string]string, error) {
+	matrix, ok := m.(map[string]any)
+	if !ok || len(matrix) == 0 {
+		return nil, fmt.Errorf("matrix of entry '%s' must map variable names to lists of values", name)
+	}
+	combinations := []map[string]string{{}}
+	for _, key := range sortedKeys(matrix) {
+		values, ok := matrix[key].([]any)
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("matrix variable '%s' of entry '%s' must be a non-empty list", key, name)
+		}
+		if len(combinations)*len(values) > maxMatrixCombinations {
+			return nil, fmt.Errorf("matrix of entry '%s' has more than %d combinations", name, maxMatrixCombinations)
+		}
+		next := make([]map[string]string, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, value := range values {
+				switch value.(type) {
+				case string, int, int64, uint64, float64, bool:
+				default:
+					return nil, fmt.Errorf("matrix variable '%s' of entry '%s' must only contain plain values", key, name)
+				}
+				vars := make(map[string]string, len(combination)+1)
+				for k, v := range combination {
+					vars[k] = v
+				}
+				vars[key] = fmt.Sprint(value)
+				next = append(next, vars)
+			}
+		}
+		combinations = next
+	}
+	return combinations, nil
+}
+
+// substituteVars replaces {{name}} in strings, lists and maps, in name order.
+func substituteVars(value any, vars map[string]string) any {
+	switch v := value.(type) {
+	case string:
+		for _, name := range sortedKeys(vars) {
+			v = strings.ReplaceAll(v, "{{"+name+"}}", vars[name])
+		}
+		return v
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = substituteVars(item, vars)
+		}
+		return list
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[k] = substituteVars(item, vars)
+		}
+		return m
+	}
+	return value
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package bangs
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
+)
+
+// Metrics of searches and registry loads; labels hold bangs of the registry, never queries.
+var (
+	searchRequests = middleware.DefaultRegistry.Counter("bangs_requests_total",
+		"Search requests by how they were resolved (bang, alias, default, ignore or error) and the error type.", "outcome", "error")
+	searchDuration = middleware.DefaultRegistry.Histogram("bangs_resolution_duration_seconds",
+		"Time to resolve and answer a search request.", middleware.DefaultBuckets, "outcome", "error")
+	bangHits = middleware.DefaultRegistry.Counter("bangs_bang_hits_total",
+		"Searches using a bang explicitly or through an alias, by the entry's bang.", "bang")
+	multiBangTabs = middleware.DefaultRegistry.Histogram("bangs_multi_bang_tabs",
+		"Tabs opened by multi-bang searches.", []float64{2, 3, 4, 5, 6, 8, 10})
+	registryReloads = middleware.DefaultRegistry.Counter("bangs_registry_reloads_total",
+		"Registry loads by result (success or failure).", "result")
+	registryLastLoad = middleware.DefaultRegistry.Gauge("bangs_registry_last_success_timestamp_seconds",
+		"Unix time of the last successful registry load.")
+	registryEntries = middleware.DefaultRegistry.Gauge("bangs_registry_entries",
+		"Entries in the loaded registry.")
+)
+
+// observeLoad counts a load of the registry or a profile file.
+func observeLoad(err error) {
+	if err != nil {
+		registryReloads.Inc("failure")
+		return
+	}
+	registryReloads.Inc("success")
+	registryLastLoad.Set(float64(time.Now().Unix()))
+}
+
+// observeSearch reports how a search was resolved and records it in the usage statistics and history.
+func observeSearch(r *http.Request, s search, err error, errType string) {
+	if err != nil {
+		switch err.(type) {
+		case UnknownBangError:
+			errType = "unknown_bang"
+		case AugmentNoPlaceholderError:
+			errType = "no_placeholder"
+		}
+		middleware.SetOutcome(r, "error", errType)
+		return
+	}
+	middleware.SetOutcome(r, s.outcome, "")
+	if s.outcome == "bang" || s.outcome == "alias" {
+		stats, now := usage, time.Now()
+		for _, entry := range s.entries {
+			bangHits.Inc(entry.Bang)
+			if stats != nil {
+				stats.Record(entry.Bang, now)
+			}
+		}
+	}
+	if len(s.entries) > 1 {
+		multiBangTabs.Observe(float64(len(s.entries)))
+	}
+	if h := history; h != nil {
+		entry := RequestRegistry(r).historyEntry(s)
+		entry.User = RequestUser(r)
+		err = h.Record(entry)
+		if err != nil {
+			slog.Error("Error recording search history", "err", err)
+		}
+	}
+}
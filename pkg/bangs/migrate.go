@@ -0,0 +1,111 @@
+package bangs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Migrate rewrites a registry file to the latest format version, keeping YAML comments.
+func Migrate(data []byte, format Format) ([]byte, error) {
+	reg, err := Parse(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if reg.Version == LatestVersion {
+		return data, nil
+	}
+
+	switch format {
+	case FormatYAML, "":
+		d, err := openRegistryDocument(data)
+		if err != nil {
+			return nil, err
+		}
+		d.migrate()
+		return d.bytes()
+	}
+
+	raw, err := decodeRaw(data, format)
+	if err != nil {
+		return nil, err
+	}
+	migrated := struct {
+		Version int            `json:"version" toml:"version"`
+		Default any            `json:"default,omitempty" toml:"default,omitempty"`
+		Aliases any            `json:"aliases,omitempty" toml:"aliases,omitempty"`
+		Bangs   map[string]any `json:"bangs" toml:"bangs"`
+	}{
+		Version: LatestVersion,
+		Default: raw["default"],
+		Aliases: raw["aliases"],
+		Bangs:   make(map[string]any, len(raw)),
+	}
+	for name, value := range raw {
+		if _, isEntry := value.(map[string]any); isEntry && name != "aliases" {
+			migrated.Bangs[name] = value
+		}
+	}
+
+	if format == FormatTOML {
+		return toml.Marshal(migrated)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(migrated)
+	if err != nil {
+		return nil, fmt.Errorf("encoding migrated registry: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// migrate moves a version 1 document to version 2.
+func (d *registryDocument) migrate() {
+	if !d.legacy {
+		return
+	}
+
+	version := stringNode("version")
+	versionValue := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: fmt.Sprint(LatestVersion)}
+	entries := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	root := []*yaml.Node{version, versionValue}
+	var defaultPair, aliasesPair []*yaml.Node
+
+	for i := 0; i+1 < len(d.root.Content); i += 2 {
+		key, value := d.root.Content[i], d.root.Content[i+1]
+		switch {
+		case key.Value == "default" && value.Kind == yaml.ScalarNode:
+			defaultPair = d.root.Content[i : i+2]
+		case key.Value == "aliases" && value.Kind == yaml.MappingNode:
+			aliasesPair = d.root.Content[i : i+2]
+		case key.Value == "version" && value.Kind == yaml.ScalarNode:
+		default:
+			entries.Content = append(entries.Content, key, value)
+		}
+	}
+
+	// Comment paragraphs above the first key but its own describe the file.
+	if len(d.root.Content) > 0 {
+		first := d.root.Content[0]
+		if i := strings.LastIndex(first.HeadComment, "\n\n"); i >= 0 {
+			version.HeadComment, first.HeadComment = first.HeadComment[:i], first.HeadComment[i+2:]
+		}
+	}
+
+	root = append(root, defaultPair...)
+	root = append(root, aliasesPair...)
+	root = append(root, stringNode("bangs"), entries)
+	if len(entries.Content) > 0 {
+		// The first entry now starts the bangs map and is no longer separated.
+		delete(d.blankBefore, entries.Content[0])
+	}
+	d.root.Content = root
+	d.entries = entries
+	d.legacy = false
+}
@@ -0,0 +1,114 @@
+package bangs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	sources := map[Format]string{
+		FormatYAML: editorTestRegistry,
+		FormatJSON: `{"default": "g", "aliases": {"search": "g"}, "Google": {"bang": "g", "url": "https://www.google.com/search?q={}"}, "GitHub": {"bang": "gh", "url": "https://github.com/search?q={}"}}`,
+		FormatTOML: "default = 'g'\n[aliases]\nsearch = 'g'\n[Google]\nbang = 'g'\nurl = 'https://www.google.com/search?q={}'\n[GitHub]\nbang = 'gh'\nurl = 'https://github.com/search?q={}'\n",
+	}
+
+	for format, source := range sources {
+		t.Run(string(format), func(t *testing.T) {
+			before, err := Parse([]byte(source), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			migrated, err := Migrate([]byte(source), format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			after, err := Parse(migrated, format)
+			if err != nil {
+				t.Fatalf("migrated registry does not parse: %v\n%s", err, migrated)
+			}
+			if after.Version != LatestVersion {
+				t.Errorf("expected version %d, got %d", LatestVersion, after.Version)
+			}
+			if after.Default != before.Default || !reflect.DeepEqual(after.Aliases, before.Aliases) {
+				t.Errorf("expected default and aliases to be kept, got %q and %v", after.Default, after.Aliases)
+			}
+			if len(after.Entries.Entries) != len(before.Entries.Entries) {
+				t.Errorf("expected %d entries, got %d", len(before.Entries.Entries), len(after.Entries.Entries))
+			}
+			for name, e := range before.Entries.Entries {
+				if !after.Entries.Entries[name].Equals(e) {
+					t.Errorf("expected entry %s to be kept as %v, got %v", name, e, after.Entries.Entries[name])
+				}
+			}
+
+			again, err := Migrate(migrated, format)
+			if err != nil || string(again) != string(migrated) {
+				t.Errorf("expected migrating twice to be a no-op, got %v:\n%s", err, again)
+			}
+		})
+	}
+}
+
+func TestMigrate_YAMLKeepsComments(t *testing.T) {
+	migrated, err := Migrate([]byte(editorTestRegistry), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `version: 2
+
+# Team bangs
+default: 'g'
+
+aliases:
+  search: 'g' # plain search
+
+bangs:
+  # ===== Search =====
+  Google:
+    bang: 'g'
+    url: 'https://www.google.com/search?q={}'
+    description: 'Search Google'
+
+  # ===== Development =====
+  GitHub:
+    bang: "gh"
+    url: "https://github.com/search?q={}"
+    category: 'Development' # keep me
+`
+	if string(migrated) != want {
+		t.Errorf("unexpected migration result:\n%s", migrated)
+	}
+}
+
+func TestRegistryDocument_EditsVersion2(t *testing.T) {
+	migrated, err := Migrate([]byte(editorTestRegistry), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := openRegistryDocument(migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.createEntry("aliases", Entry{Bang: "al", URL: "https://example.com/?q={}"})
+	if err != nil {
+		t.Fatalf("expected reserved names to be allowed as entries in version 2, got %v", err)
+	}
+	err = d.deleteEntry("Google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := Parse(data, FormatYAML)
+	if err != nil {
+		t.Fatalf("edited document does not parse: %v\n%s", err, data)
+	}
+	if _, ok := reg.Entries.Entries["aliases"]; !ok {
+		t.Errorf("expected new entry under bangs, got:\n%s", data)
+	}
+	if _, ok := reg.Entries.Entries["Google"]; ok {
+		t.Errorf("expected Google to be deleted, got:\n%s", data)
+	}
+}
@@ -0,0 +1,206 @@
+package bangs
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// NamedEntry is an entry with its name and the section it was declared in.
+type NamedEntry struct {
+	Name    string `json:"name"`
+	Section string `json:"section,omitempty"`
+	Entry
+}
+
+// Ordered returns the entries in declaration order, with YAML banner sections or the category as section.
+func (bl BangList) Ordered() []NamedEntry {
+	names := bl.order
+	if len(names) != len(bl.Entries) {
+		names = bl.names()
+	}
+	ordered := make([]NamedEntry, 0, len(names))
+	for _, name := range names {
+		entry := bl.Entries[name]
+		section, ok := bl.sections[name]
+		if !ok && entry.Template != "" {
+			section, ok = bl.sections[entry.Template]
+		}
+		if !ok {
+			section = entry.Category
+		}
+		ordered = append(ordered, NamedEntry{Name: name, Section: section, Entry: entry})
+	}
+	return ordered
+}
+
+// names returns the entry names sorted, for lists built without source order.
+func (bl BangList) names() []string {
+	names := make([]string, 0, len(bl.Entries))
+	for name := range bl.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setOrder keeps the declaration order of the entries, appending unordered ones sorted.
+func (bl *BangList) setOrder(order []string, sections map[string]string) {
+	seen := make(map[string]bool, len(bl.Entries))
+	bl.order = make([]string, 0, len(bl.Entries))
+	for _, name := range order {
+		for _, n := range append([]string{name}, bl.expanded[name]...) {
+			if _, ok := bl.Entries[n]; ok && !seen[n] {
+				seen[n] = true
+				bl.order = append(bl.order, n)
+			}
+		}
+	}
+	for _, name := range bl.names() {
+		if !seen[name] {
+			bl.order = append(bl.order, name)
+		}
+	}
+	bl.sections = sections
+}
+
+// declarationOrder reads the entry names of a registry file in source order, and YAML sections.
+func declarationOrder(data []byte, format Format, version int) ([]string, map[string]string) {
+	switch format {
+	case FormatJSON:
+		return jsonOrder(data, version), nil
+	case FormatTOML:
+		return tomlOrder(data, version), nil
+	}
+	return yamlOrder(data, version)
+}
+
+func yamlOrder(data []byte, version int) ([]string, map[string]string) {
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	mapping := doc.Content[0]
+	if version > 1 {
+		i := mappingIndex(mapping, "bangs")
+		if i < 0 {
+			return nil, nil
+		}
+		mapping = mapping.Content[i+1]
+	}
+	return mappingOrder(mapping)
+}
+
+// mappingOrder lists the keys of a mapping and the sections their banner comments start.
+func mappingOrder(mapping *yaml.Node) ([]string, map[string]string) {
+	if mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var order []string
+	sections := make(map[string]string)
+	section, found := "", false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i]
+		if title, ok := sectionTitle(key.HeadComment); ok {
+			section, found = title, true
+		}
+		order = append(order, key.Value)
+		sections[key.Value] = section
+	}
+	if !found {
+		return order, nil
+	}
+	return order, sections
+}
+
+// sectionTitle extracts the title of a banner comment like "# ===== Search =====".
+func sectionTitle(comment string) (string, bool) {
+	if comment == "" {
+		return "", false
+	}
+	paragraphs := strings.Split(comment, "\n\n")
+	const decoration = "=-#*~_"
+	banner, title := false, ""
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		trimmed := strings.TrimSpace(strings.Trim(line, decoration))
+		if len(line)-len(trimmed) >= 3 {
+			banner = true
+		}
+		if title == "" {
+			title = trimmed
+		}
+	}
+	return title, banner && title != ""
+}
+
+func jsonOrder(data []byte, version int) []string {
+	if version > 1 {
+		var top map[string]json.RawMessage
+		if json.Unmarshal(data, &top) != nil {
+			return nil
+		}
+		data = top["bangs"]
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var order []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return order
+		}
+		key, _ := t.(string)
+		order = append(order, key)
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return order
+		}
+	}
+	return order
+}
+
+func tomlOrder(data []byte, version int) []string {
+	var order []string
+	var table []string
+	p := unstable.Parser{}
+	p.Reset(data)
+	for p.NextExpression() {
+		expr := p.Expression()
+		var path []string
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = tomlKey(expr)
+			path = table
+		case unstable.KeyValue:
+			path = append(append([]string{}, table...), tomlKey(expr)...)
+		default:
+			continue
+		}
+		if version > 1 {
+			if len(path) < 2 || path[0] != "bangs" {
+				continue
+			}
+			path = path[1:]
+		}
+		if len(path) > 0 {
+			order = append(order, path[0])
+		}
+	}
+	return order
+}
+
+func tomlKey(expr *unstable.Node) []string {
+	var key []string
+	it := expr.Key()
+	for it.Next() {
+		key = append(key, string(it.Node().Data))
+	}
+	return key
+}
@@ -0,0 +1,67 @@
+package bangs
+
+import (
+	"maps"
+	"slices"
+)
+
+// Overlay returns a new registry with the entries, aliases and default of o layered over r.
+func (r *Registry) Overlay(o *Registry) *Registry {
+	merged := &Registry{
+		Version:    r.Version,
+		Default:    r.Default,
+		Aliases:    make(map[string]string, len(r.Aliases)+len(o.Aliases)),
+		AliasTests: make(map[string][]TestCase),
+	}
+	if o.Default != "" {
+		merged.Default = o.Default
+	}
+	maps.Copy(merged.Aliases, r.Aliases)
+	maps.Copy(merged.Aliases, o.Aliases)
+	maps.Copy(merged.AliasTests, r.AliasTests)
+	maps.Copy(merged.AliasTests, o.AliasTests)
+
+	bl := &merged.Entries
+	bl.Entries = make(map[string]Entry, len(r.Entries.Entries)+len(o.Entries.Entries))
+	bl.byBang = make(map[string]Entry, len(r.Entries.byBang)+len(o.Entries.byBang))
+	bl.expanded = make(map[string][]string)
+	sections := make(map[string]string)
+	order := make([]string, 0, len(r.Entries.Entries)+len(o.Entries.Entries))
+
+	for _, entry := range o.Entries.Ordered() {
+		bl.Entries[entry.Name] = entry.Entry
+		order = append(order, entry.Name)
+		sections[entry.Name] = entry.Section
+	}
+	maps.Copy(bl.byBang, o.Entries.byBang)
+	maps.Copy(bl.expanded, o.Entries.expanded)
+
+	for _, entry := range r.Entries.Ordered() {
+		if _, ok := bl.Entries[entry.Name]; ok {
+			continue
+		}
+		shadowed := slices.ContainsFunc(append([]string{entry.Bang}, entry.Aliases...), func(bang string) bool {
+			_, ok := o.Entries.byBang[bang]
+			return ok
+		})
+		if shadowed {
+			continue
+		}
+		bl.Entries[entry.Name] = entry.Entry
+		bl.byBang[entry.Bang] = entry.Entry
+		for _, alias := range entry.Aliases {
+			bl.byBang[alias] = entry.Entry
+		}
+		order = append(order, entry.Name)
+		sections[entry.Name] = entry.Section
+	}
+	for template, names := range r.Entries.expanded {
+		if _, ok := bl.expanded[template]; !ok {
+			bl.expanded[template] = names
+		}
+	}
+	bl.len = len(bl.Entries)
+	bl.setOrder(order, sections)
+	merged.completions = newCompletionIndex(merged)
+	return merged
+}
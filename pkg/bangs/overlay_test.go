@@ -0,0 +1,81 @@
+package bangs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Overlay(t *testing.T) {
+	base, err := Parse([]byte(`
+default: 'g'
+aliases:
+  code: 'gh'
+  s: 'g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+  aliases: ['hub']
+Wikipedia:
+  bang: 'w'
+  url: 'https://en.wikipedia.org/wiki/Special:Search?search={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := Parse([]byte(`
+default: 'intra'
+aliases:
+  code: 'gl'
+Intranet:
+  bang: 'intra'
+  url: 'https://intranet.example.com/?q={}'
+GitLab:
+  bang: 'gl'
+  url: 'https://gitlab.example.com/search?search={}'
+My GitHub:
+  bang: 'hub'
+  url: 'https://github.com/me?tab=repositories&q={}'
+Google:
+  bang: 'g'
+  url: 'https://www.google.de/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := base.Overlay(overlay)
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"!g a", "https://www.google.de/search?q=a"},
+		{"!w a", "https://en.wikipedia.org/wiki/Special:Search?search=a"},
+		{"!code a", "https://gitlab.example.com/search?search=a"},
+		{"!s a", "https://www.google.de/search?q=a"},
+		{"!hub a", "https://github.com/me?tab=repositories&q=a"},
+		{"##a", "https://intranet.example.com/?q=a"},
+	}
+	for _, tt := range tests {
+		got, err := merged.Resolve(tt.input)
+		if err != nil || len(got) != 1 || got[0] != tt.want {
+			t.Errorf("Resolve(%q): expected %s, got %v, %v", tt.input, tt.want, got, err)
+		}
+	}
+	if _, err := merged.Resolve("!gh a"); err == nil {
+		t.Errorf("expected GitHub to be shadowed by the overlay's hub bang")
+	}
+
+	names := make([]string, 0)
+	for _, entry := range merged.Entries.Ordered() {
+		names = append(names, entry.Name)
+	}
+	if want := "Intranet GitLab My GitHub Google Wikipedia"; strings.Join(names, " ") != want {
+		t.Errorf("expected overlay entries first, got %v", names)
+	}
+	if got, _ := base.Resolve("!g a"); got[0] != "https://www.google.com/search?q=a" {
+		t.Errorf("expected the base registry to be unchanged, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package bangs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a registry served for some hosts, optionally layered over a base file.
+type Profile struct {
+	Hosts []string `yaml:"hosts"`
+	File  string   `yaml:"file"`
+	Base  string   `yaml:"base,omitempty"`
+}
+
+type profilesFile struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+type profileKey struct{}
+
+// RequestProfile returns the profile a request was served from, or "" for the loaded registry.
+func RequestProfile(r *http.Request) string {
+	name, _ := r.Context().Value(profileKey{}).(string)
+	return name
+}
+
+// Profiles picks the registry of a request by its Host header.
+type Profiles struct {
+	mu       sync.RWMutex
+	profiles map[string]Profile
+	byHost   map[string]string
+	// files holds every parsed profile and base file by path, registries the profiles built from them.
+	files      map[string]*Registry
+	registries map[string]*Registry
+}
+
+// LoadProfiles reads the profiles config at path, resolving file paths against its directory.
+func LoadProfiles(path string) (*Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config profilesFile
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("reading profiles %s: %w", path, err)
+	}
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles defined in %s", path)
+	}
+
+	p := &Profiles{
+		profiles:   make(map[string]Profile, len(config.Profiles)),
+		byHost:     make(map[string]string),
+		files:      make(map[string]*Registry),
+		registries: make(map[string]*Registry, len(config.Profiles)),
+	}
+	dir := filepath.Dir(path)
+	for _, name := range sortedKeys(config.Profiles) {
+		profile := config.Profiles[name]
+		if profile.File == "" {
+			return nil, fmt.Errorf("profile '%s' needs a file", name)
+		}
+		if len(profile.Hosts) == 0 {
+			return nil, fmt.Errorf("profile '%s' needs at least one host", name)
+		}
+		profile.File = resolvePath(dir, profile.File)
+		if profile.Base != "" {
+			profile.Base = resolvePath(dir, profile.Base)
+		}
+		for _, host := range profile.Hosts {
+			host = normalizeHost(host)
+			if other, ok := p.byHost[host]; ok {
+				return nil, fmt.Errorf("host '%s' is used by profiles '%s' and '%s'", host, other, name)
+			}
+			p.byHost[host] = name
+		}
+		p.profiles[name] = profile
+	}
+	for _, file := range p.Files() {
+		reg, err := ParseFile(file, "")
+		if err != nil {
+			return nil, fmt.Errorf("profile file %s: %w", file, err)
+		}
+		p.files[file] = reg
+	}
+	for name := range p.profiles {
+		p.build(name)
+	}
+	slog.Info("Loaded registry profiles", "file", path, "N", len(p.profiles))
+	return p, nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// normalizeHost lower-cases host and removes its port and trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// Files returns the profile and base files, sorted, so each can be watched.
+func (p *Profiles) Files() []string {
+	var files []string
+	for _, profile := range p.profiles {
+		files = append(files, profile.File)
+		if profile.Base != "" {
+			files = append(files, profile.Base)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// build sets the registry of a profile from its parsed files; the caller must hold p.mu or own p.
+func (p *Profiles) build(name string) {
+	profile := p.profiles[name]
+	reg := p.files[profile.File]
+	if profile.Base != "" {
+		reg = p.files[profile.Base].Overlay(reg)
+	}
+	for _, problem := range reg.Validate() {
+		slog.Warn("Problem in profile registry", "profile", name, "problem", problem)
+	}
+	p.registries[name] = reg
+}
+
+// Reload parses file again and rebuilds the profiles using it, reporting the outcome in the load status.
+func (p *Profiles) Reload(file string) error {
+	reg, err := ParseFile(file, "")
+	if err != nil {
+		err = fmt.Errorf("profile file %s: %w", file, err)
+	}
+	observeLoad(err)
+	statusMu.Lock()
+	setLoadError(file, err)
+	statusMu.Unlock()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[file] = reg
+	for name, profile := range p.profiles {
+		if profile.File == file || profile.Base == file {
+			p.build(name)
+			slog.Info("Reloaded registry profile", "profile", name, "file", file)
+		}
+	}
+	return nil
+}
+
+// Registry returns the registry of a profile, or nil if there is none.
+func (p *Profiles) Registry(name string) *Registry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.registries[name]
+}
+
+// ForHost returns the profile serving host, or "" if there is none.
+func (p *Profiles) ForHost(host string) string {
+	return p.byHost[normalizeHost(host)]
+}
+
+// Middleware makes requests for the hosts of a profile use its registry.
+func (p *Profiles) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := p.ForHost(r.Host); name != "" {
+			ctx := context.WithValue(r.Context(), profileKey{}, name)
+			ctx = context.WithValue(ctx, registryKey{}, p.Registry(name))
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
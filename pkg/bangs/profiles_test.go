@@ -0,0 +1,189 @@
+package bangs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	SetOptions(false, false, ".")
+
+	reg, err := Parse([]byte(`
+default: 'https://duckduckgo.com/?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.yaml", `
+default: 'g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+`)
+	write("work.yaml", `
+default: 'jira'
+Jira:
+  bang: 'jira'
+  url: 'https://jira.example.com/secure/QuickSearch.jspa?searchString={}'
+`)
+	write("home.json", `{"aliases": {"s": "g"}}`)
+	profilesPath := write("profiles.yaml", `
+profiles:
+  work:
+    hosts: [bangs.work, Work.Example.com]
+    file: work.yaml
+    base: base.yaml
+  home:
+    hosts: [bangs.home]
+    file: home.json
+    base: base.yaml
+`)
+
+	profiles, err := LoadProfiles(profilesPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files := profiles.Files(); len(files) != 3 {
+		t.Errorf("expected base, work and home files, got %v", files)
+	}
+	handler := profiles.Middleware(Handler(false, false, "."))
+	search := func(host, q string) string {
+		r := httptest.NewRequest("GET", "/?q="+q, nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get("Location")
+	}
+
+	tests := []struct {
+		host, q, want string
+	}{
+		{"bangs.work", "%23%23a", "https://jira.example.com/secure/QuickSearch.jspa?searchString=a"},
+		{"work.example.com:8080", "!g+a", "https://www.google.com/search?q=a"},
+		{"bangs.home", "%23%23a", "https://www.google.com/search?q=a"},
+		{"bangs.home", "!s+a", "https://www.google.com/search?q=a"},
+		{"localhost:8080", "%23%23a", "https://duckduckgo.com/?q=a"},
+	}
+	for _, tt := range tests {
+		if got := search(tt.host, tt.q); got != tt.want {
+			t.Errorf("%s ?q=%s: expected %s, got %s", tt.host, tt.q, tt.want, got)
+		}
+	}
+
+	write("base.yaml", `
+default: 'g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.de/search?q={}'
+`)
+	if err := profiles.Reload(base); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := search("bangs.home", "%23%23a"); got != "https://www.google.de/search?q=a" {
+		t.Errorf("expected the reloaded base in the home profile, got %s", got)
+	}
+	if got := search("bangs.work", "!g+a"); got != "https://www.google.de/search?q=a" {
+		t.Errorf("expected the reloaded base in the work profile, got %s", got)
+	}
+	write("base.yaml", "{")
+	if err := profiles.Reload(base); err == nil {
+		t.Errorf("expected an error for a broken file")
+	}
+	if got := search("bangs.home", "%23%23a"); got != "https://www.google.de/search?q=a" {
+		t.Errorf("expected a failed reload to keep the profile, got %s", got)
+	}
+	if status := CurrentStatus(); !strings.Contains(status.LastError, base) {
+		t.Errorf("expected the failed profile reload in the status, got %+v", status)
+	}
+	write("base.yaml", "default: 'g'\nGoogle:\n  bang: 'g'\n  url: 'https://www.google.com/search?q={}'\n")
+	if err := profiles.Reload(base); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := CurrentStatus(); strings.Contains(status.LastError, base) {
+		t.Errorf("expected a successful reload to clear the error, got %+v", status)
+	}
+
+	editor := profiles.Middleware(EditorHandler(filepath.Join(dir, "bangs.yaml"), "", "secret"))
+	r := httptest.NewRequest("DELETE", "/entries/Jira", nil)
+	r.Host = "bangs.work"
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	editor.ServeHTTP(w, r)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected editing a profile to be rejected, got %d", w.Code)
+	}
+
+	write("profiles.yaml", `
+profiles:
+  a:
+    hosts: [bangs.test]
+    file: work.yaml
+  b:
+    hosts: [BANGS.test]
+    file: work.yaml
+`)
+	if _, err := LoadProfiles(profilesPath); err == nil {
+		t.Errorf("expected an error for a host used by two profiles")
+	}
+	write("profiles.yaml", "profiles:\n  a:\n    file: work.yaml\n")
+	if _, err := LoadProfiles(profilesPath); err == nil {
+		t.Errorf("expected an error for a profile without hosts")
+	}
+}
+
+func TestProfiles_WithUsers(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	SetOptions(false, false, ".")
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "work.yaml"), []byte(`
+Jira:
+  bang: 'jira'
+  url: 'https://jira.example.com/?q={}'
+`), 0o600)
+	os.WriteFile(filepath.Join(dir, "profiles.yaml"), []byte("profiles:\n  work:\n    hosts: [bangs.work]\n    file: work.yaml\n"), 0o600)
+	overlays := filepath.Join(dir, "overlays")
+	os.Mkdir(overlays, 0o700)
+	os.WriteFile(filepath.Join(overlays, "alice.yaml"), []byte(`
+aliases:
+  j: 'jira'
+`), 0o600)
+
+	profiles, err := LoadProfiles(filepath.Join(dir, "profiles.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := NewUsers("", map[string]string{"alice": "token"}, overlays, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := profiles.Middleware(users.Middleware(Handler(false, false, ".")))
+
+	r := httptest.NewRequest("GET", "/u/alice/?q=!j+a", nil)
+	r.Host = "bangs.work"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Location"); got != "https://jira.example.com/?q=a" {
+		t.Errorf("expected alice's overlay layered over the work profile, got %d %s", w.Code, got)
+	}
+	if w.Code != http.StatusFound {
+		t.Errorf("expected a redirect, got %d", w.Code)
+	}
+}
@@ -5,57 +5,137 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-var registry *Registry
+// registry is the loaded registry. Reloads swap it while requests read it.
+var registry atomic.Pointer[Registry]
 
 type Registry struct {
+	Version int               `yaml:"version,omitempty" json:"version,omitempty"`
 	Default QueryURL          `yaml:"default" json:"default"`
 	Aliases map[string]string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
 	Entries BangList          `yaml:",inline" json:"bangs"`
+	// AliasTests are the tests declared by aliases written as {target: ..., tests: [...]}.
+	AliasTests map[string][]TestCase `yaml:"-" json:"-"`
+
+	completions *completionIndex
 }
 
 var allowNoBang = false
 var ignoreChar = "."
 var allowMultiBang = false
 
+// SetOptions sets how search input is interpreted, see Handler.
+func SetOptions(doAllowNoBang bool, doAllowMultiBang bool, ignoreCharPar string) {
+	allowNoBang = doAllowNoBang
+	ignoreChar = ignoreCharPar
+	allowMultiBang = doAllowMultiBang
+}
+
+// Load reads the registry file at path, picking the format by its extension.
 func Load(path string) error {
-	data, err := os.ReadFile(path)
+	return LoadFormat(path, "")
+}
+
+// Status describes the loaded registry and the outcome of the last load.
+type Status struct {
+	// Generation counts the successful loads, starting at 1.
+	Generation int       `json:"generation"`
+	Entries    int       `json:"entries"`
+	LoadedAt   time.Time `json:"loadedAt"`
+	Source     string    `json:"source"`
+	// LastError is the error of the last failed load of the registry or a profile file.
+	LastError string `json:"lastError,omitempty"`
+}
+
+var (
+	statusMu sync.RWMutex
+	status   Status
+	// loadErrors holds the error of every file whose last load failed.
+	loadErrors = make(map[string]string)
+)
+
+// setLoadError records the outcome of loading path; the caller must hold statusMu.
+func setLoadError(path string, err error) {
 	if err != nil {
-		return err
+		loadErrors[path] = err.Error()
+	} else {
+		delete(loadErrors, path)
+	}
+	status.LastError = ""
+	if files := sortedKeys(loadErrors); len(files) > 0 {
+		status.LastError = loadErrors[files[0]]
 	}
+}
+
+// CurrentStatus returns the status of the loaded registry, generation 0 before the first load.
+func CurrentStatus() Status {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return status
+}
+
+type registryKey struct{}
+
+// RequestRegistry returns the registry Profiles or Users selected for a request, or the loaded one.
+func RequestRegistry(r *http.Request) *Registry {
+	if reg, ok := r.Context().Value(registryKey{}).(*Registry); ok {
+		return reg
+	}
+	return registry.Load()
+}
 
-	var reg Registry
-	err = yaml.Unmarshal(data, &reg)
+// LoadFormat reads the registry file at path in format, detected from the extension if empty.
+func LoadFormat(path string, format Format) error {
+	reg, err := ParseFile(path, format)
+	observeLoad(err)
 	if err != nil {
+		statusMu.Lock()
+		setLoadError(path, err)
+		statusMu.Unlock()
 		return err
 	}
+	for _, problem := range reg.Validate() {
+		slog.Warn("Problem in bang registry", "file", path, "problem", problem)
+	}
 
 	debugEnabled := slog.Default().Enabled(context.Background(), slog.LevelDebug)
 
-	if registry != nil && debugEnabled {
-		diffRegistry(registry, &reg)
+	old := registry.Swap(reg)
+	registryEntries.Set(float64(len(reg.Entries.Entries)))
+	if old != nil && debugEnabled {
+		diffRegistry(old, reg)
 	}
 
-	registry = &reg
-	slog.Info("Loaded bang registry", "file", path, "N", len(registry.Entries.Entries))
+	statusMu.Lock()
+	status = Status{
+		Generation: status.Generation + 1,
+		Entries:    len(reg.Entries.Entries),
+		LoadedAt:   time.Now(),
+		Source:     path,
+	}
+	setLoadError(path, nil)
+	statusMu.Unlock()
+	slog.Info("Loaded bang registry", "file", path, "N", len(reg.Entries.Entries))
 	if debugEnabled {
-		keys := make([]string, 0, len(registry.Entries.Entries))
-		for k := range registry.Entries.Entries {
-			keys = append(keys, k)
+		keys := make([]string, 0, len(reg.Entries.Entries))
+		for _, e := range reg.Entries.Ordered() {
+			keys = append(keys, e.Name)
 		}
 		slog.Debug("All loaded bangs", "names", keys)
 
-		if len(registry.Aliases) > 0 {
-			aliasKeys := make([]string, 0, len(registry.Aliases))
-			for k := range registry.Aliases {
+		if len(reg.Aliases) > 0 {
+			aliasKeys := make([]string, 0, len(reg.Aliases))
+			for k := range reg.Aliases {
 				aliasKeys = append(aliasKeys, k)
 			}
-			slog.Debug("All loaded aliases", "aliases", registry.Aliases)
+			slog.Debug("All loaded aliases", "aliases", reg.Aliases)
 		}
 	}
 	return nil
@@ -87,13 +167,32 @@ func (r *Registry) DefaultForward(query string, w http.ResponseWriter, req *http
 }
 
 func (r *Registry) handleDefaultBangReferences(defaultStr, query string, w http.ResponseWriter, req *http.Request) error {
+	entries, err := r.defaultEntries(defaultStr, nil)
+	if err != nil {
+		msg := err.Error()
+		http.Error(w, strings.ToUpper(msg[:1])+msg[1:], http.StatusInternalServerError)
+		return err
+	}
+
+	// Handle single vs multi-bang
+	if len(entries) == 1 {
+		// Single bang - direct redirect
+		slog.Debug("Single bang default, redirecting", "bang", entries[0].Bang)
+		return entries[0].Forward(query, w, req)
+	}
+
+	slog.Debug("Multi-bang default, generating HTML", "bangCount", len(entries))
+	return generateMultiTabHTML(entries, query, w, req)
+}
+
+// defaultEntries resolves a default made of bang and alias references.
+func (r *Registry) defaultEntries(defaultStr string, x *Explanation) ([]*Entry, error) {
 	// Parse bang references (support multi-bang with +)
-	bangRefs := strings.Split(defaultStr, "+")
+	bangRefs := splitRefs(defaultStr)
 	entries := make([]*Entry, 0, len(bangRefs))
 
 	// Resolve each bang reference to an Entry
 	for _, bangRef := range bangRefs {
-		bangRef = strings.TrimSpace(bangRef)
 		if bangRef == "" {
 			continue
 		}
@@ -101,18 +200,16 @@ func (r *Registry) handleDefaultBangReferences(defaultStr, query string, w http.
 		// Check if it's an alias first
 		if alias, exists := r.Aliases[bangRef]; exists {
 			slog.Debug("Resolved alias in default", "alias", bangRef, "target", alias)
+			x.step("alias", "'%s' in the default is an alias for '%s'", bangRef, alias)
 			// Recursively handle the alias target (which might be multi-bang)
-			aliasRefs := strings.Split(alias, "+")
-			for _, aliasRef := range aliasRefs {
-				aliasRef = strings.TrimSpace(aliasRef)
+			for _, aliasRef := range splitRefs(alias) {
 				if aliasRef == "" {
 					continue
 				}
 				entry, exists := r.Entries.byBang[aliasRef]
 				if !exists {
 					slog.Error("Default alias target bang not found", "alias", bangRef, "target", aliasRef)
-					http.Error(w, fmt.Sprintf("Default alias '%s' target bang '%s' not found", bangRef, aliasRef), http.StatusInternalServerError)
-					return fmt.Errorf("default alias '%s' target bang '%s' not found", bangRef, aliasRef)
+					return nil, fmt.Errorf("default alias '%s' target bang '%s' not found", bangRef, aliasRef)
 				}
 				entries = append(entries, &entry)
 			}
@@ -121,16 +218,14 @@ func (r *Registry) handleDefaultBangReferences(defaultStr, query string, w http.
 			entry, exists := r.Entries.byBang[bangRef]
 			if !exists {
 				slog.Error("Default bang reference not found", "bang", bangRef)
-				http.Error(w, fmt.Sprintf("Default bang reference '%s' not found", bangRef), http.StatusInternalServerError)
-				return fmt.Errorf("default bang reference '%s' not found", bangRef)
+				return nil, fmt.Errorf("default bang reference '%s' not found", bangRef)
 			}
 			entries = append(entries, &entry)
 		}
 	}
 
 	if len(entries) == 0 {
-		http.Error(w, "No valid bang references found in default", http.StatusInternalServerError)
-		return fmt.Errorf("no valid bang references found in default")
+		return nil, fmt.Errorf("no valid bang references found in default")
 	}
 
 	slog.Debug("Default bang resolution complete", "entryCount", len(entries), "entries", func() []string {
@@ -140,16 +235,101 @@ func (r *Registry) handleDefaultBangReferences(defaultStr, query string, w http.
 		}
 		return names
 	}())
+	return entries, nil
+}
 
-	// Handle single vs multi-bang
-	if len(entries) == 1 {
-		// Single bang - direct redirect
-		slog.Debug("Single bang default, redirecting", "bang", entries[0].Bang)
-		return entries[0].Forward(query, w, req)
+// Resolve returns the URLs a search for input is sent to.
+func (r *Registry) Resolve(input string) ([]string, error) {
+	s, err := r.resolve(input, nil)
+	if err != nil {
+		return nil, err
 	}
+	return r.urls(s)
+}
 
-	slog.Debug("Multi-bang default, generating HTML", "bangCount", len(entries))
-	return generateMultiTabHTML(entries, query, w)
+// search is a query resolved against a registry.
+type search struct {
+	// outcome is bang, alias, default or ignore, the labels of the metrics.
+	outcome string
+	// bang is the bang or alias as typed, for bang and alias searches.
+	bang  string
+	query string
+	// entries are the entries the search goes to, none for a URL default.
+	entries []*Entry
+}
+
+// resolve finds the entries input goes to, recording every decision in x if it is not nil.
+func (r *Registry) resolve(input string, x *Explanation) (search, error) {
+	if strings.TrimSpace(input) == "" {
+		return search{}, fmt.Errorf("no query provided for search")
+	}
+	if query, ok := strings.CutPrefix(input, "##"); ok {
+		x.step("double_hash", "The input starts with ##, so it goes to the default without looking for a bang")
+		return r.resolveDefaultSearch("default", query, x)
+	}
+	entries, bang, query, err := r.Entries.prepareInput(input, r.Aliases, x)
+	switch err.(type) {
+	case nil:
+	case InputHasNoBangError:
+		return r.resolveDefaultSearch("default", input, x)
+	case InputStartsWithIgnoreError:
+		return r.resolveDefaultSearch("ignore", input[1:], x)
+	default:
+		return search{}, err
+	}
+	s := search{outcome: "bang", bang: bang, query: query, entries: entries}
+	if _, ok := r.Aliases[bang]; ok {
+		s.outcome = "alias"
+	}
+	return s, nil
+}
+
+func (r *Registry) resolveDefaultSearch(outcome, query string, x *Explanation) (search, error) {
+	s := search{outcome: outcome, query: query}
+	defaultStr := string(r.Default)
+	if strings.Contains(defaultStr, "://") {
+		x.step("default", "The default is the URL '%s'", defaultStr)
+		return s, nil
+	}
+	x.step("default", "The default refers to '%s'", defaultStr)
+	var err error
+	s.entries, err = r.defaultEntries(defaultStr, x)
+	return s, err
+}
+
+// urls returns the URLs s goes to.
+func (r *Registry) urls(s search) ([]string, error) {
+	if len(s.entries) == 0 {
+		u, err := r.Default.Augment(s.query)
+		if err != nil {
+			return nil, err
+		}
+		return []string{u.String()}, nil
+	}
+	return augmentAll(s.entries, s.query)
+}
+
+// forward redirects to a single entry or URL default, or opens every entry in a tab.
+func (r *Registry) forward(s search, w http.ResponseWriter, req *http.Request) error {
+	switch len(s.entries) {
+	case 0:
+		return r.DefaultForward(s.query, w, req)
+	case 1:
+		return s.entries[0].Forward(s.query, w, req)
+	}
+	return generateMultiTabHTML(s.entries, s.query, w, req)
+}
+
+func augmentAll(entries []*Entry, query string) ([]string, error) {
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		u, err := entry.URL.Augment(query)
+		if err != nil {
+			return nil, err
+		}
+		urls[i] = u.String()
+	}
+	return urls, nil
 }
 
 func diffRegistry(oldRegistry, newRegistry *Registry) {
@@ -179,13 +359,19 @@ func diffRegistry(oldRegistry, newRegistry *Registry) {
 }
 
 func All() BangList {
-	return registry.Entries
+	return registry.Load().Entries
 }
 
 type BangList struct {
 	Entries map[string]Entry
 	byBang  map[string]Entry
 	len     int
+
+	// order and sections keep the layout of the registry file, see Ordered.
+	order    []string
+	sections map[string]string
+	// expanded lists the entries generated by each matrix entry.
+	expanded map[string][]string
 }
 
 func (bl *BangList) UnmarshalYAML(value *yaml.Node) error {
@@ -196,7 +382,30 @@ func (bl *BangList) UnmarshalYAML(value *yaml.Node) error {
 	}
 	delete(tempMap, "default")
 	delete(tempMap, "aliases")
+	err = bl.fromEntries(tempMap)
+	if err != nil {
+		return err
+	}
+	bl.setOrder(mappingOrder(value))
+	return nil
+}
 
+// fromEntries fills the list from decoded entries of any format and version.
+func (bl *BangList) fromEntries(tempMap map[string]any) error {
+	tempMap, err := resolveExtends(tempMap)
+	if err != nil {
+		return err
+	}
+	tempMap, bl.expanded, err = expandMatrix(tempMap)
+	if err != nil {
+		return err
+	}
+	generatedBy := make(map[string]string)
+	for template, names := range bl.expanded {
+		for _, name := range names {
+			generatedBy[name] = template
+		}
+	}
 	bl.Entries = make(map[string]Entry, len(tempMap))
 	bl.byBang = make(map[string]Entry, len(tempMap))
 	for k, a := range tempMap {
@@ -220,6 +429,10 @@ func (bl *BangList) UnmarshalYAML(value *yaml.Node) error {
 		if !ok {
 			return fmt.Errorf("missing url field for entry %s", k)
 		}
+		urlStr, err := interpolate(urlStr)
+		if err != nil {
+			return fmt.Errorf("url of entry '%s': %w", k, err)
+		}
 		description, ok := v["description"].(string)
 		if !ok {
 			description = ""
@@ -234,14 +447,104 @@ func (bl *BangList) UnmarshalYAML(value *yaml.Node) error {
 			Description: description,
 			Category:    category,
 		}
+		err = entry.readMetadata(k, v)
+		if err != nil {
+			return err
+		}
+		entry.Template = generatedBy[k]
+		for _, alias := range entry.Aliases {
+			if _, ok := bl.byBang[alias]; ok || alias == bangChars {
+				return fmt.Errorf("duplicate bang found for '%s': %s", k, alias)
+			}
+		}
 		bl.Entries[k] = entry
 		bl.byBang[bangChars] = entry
+		for _, alias := range entry.Aliases {
+			bl.byBang[alias] = entry
+		}
 	}
 	bl.len = len(tempMap)
 
 	return nil
 }
 
+// readMetadata reads the optional fields of an entry used by listings and notices.
+func (e *Entry) readMetadata(name string, v map[string]any) error {
+	var err error
+	e.Tags, err = stringList(v, "tags", name)
+	if err != nil {
+		return err
+	}
+	e.Examples, err = stringList(v, "examples", name)
+	if err != nil {
+		return err
+	}
+	e.Aliases, err = stringList(v, "aliases", name)
+	if err != nil {
+		return err
+	}
+	for i, alias := range e.Aliases {
+		e.Aliases[i] = strings.TrimSpace(alias)
+		if e.Aliases[i] == "" {
+			return fmt.Errorf("empty alias for entry '%s'", name)
+		}
+	}
+
+	e.Extends, _ = v["extends"].(string)
+
+	icon, ok := v["icon"].(string)
+	if !ok {
+		icon = faviconURL(string(e.URL))
+	}
+	e.Icon = icon
+
+	for _, key := range []string{"hidden", "deprecated"} {
+		if b, ok := v[key]; ok {
+			if _, isBool := b.(bool); !isBool {
+				return fmt.Errorf("field '%s' of entry '%s' must be true or false", key, name)
+			}
+		}
+	}
+	e.Hidden, _ = v["hidden"].(bool)
+	e.Deprecated, _ = v["deprecated"].(bool)
+	if r, ok := v["replacement"]; ok {
+		replacement, ok := r.(string)
+		if !ok {
+			return fmt.Errorf("field 'replacement' of entry '%s' must be a string", name)
+		}
+		e.Replacement = strings.TrimSpace(replacement)
+		e.Deprecated = e.Deprecated || e.Replacement != ""
+	}
+	if t, ok := v["tests"]; ok {
+		e.Tests, err = readTests(t, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringList reads an optional list of strings from a decoded entry.
+func stringList(v map[string]any, key, name string) ([]string, error) {
+	raw, ok := v[key]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("field '%s' of entry '%s' must be a list of strings", key, name)
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("field '%s' of entry '%s' must be a list of strings", key, name)
+		}
+		list = append(list, str)
+	}
+	return list, nil
+}
+
 type InputHasNoBangError string
 
 func (InputHasNoBangError) Error() string {
@@ -254,6 +557,12 @@ func (InputStartsWithIgnoreError) Error() string {
 	return "input starts with ignore character"
 }
 
+type UnknownBangError string
+
+func (e UnknownBangError) Error() string {
+	return fmt.Sprintf("unknown bang: '%s'", string(e))
+}
+
 func (bl BangList) PrepareInputOld(input string) (*Entry, string, error) {
 	if !allowNoBang && len(input) < 2 {
 		return nil, "", fmt.Errorf("len(query) was smaller than 2, which is not valid")
@@ -295,24 +604,45 @@ func (bl BangList) PrepareInputOld(input string) (*Entry, string, error) {
 }
 
 func (bl BangList) PrepareInput(input string) ([]*Entry, string, error) {
+	entries, _, query, err := bl.prepareInput(input, registry.Load().Aliases, nil)
+	return entries, query, err
+}
+
+// splitRefs splits a multi-bang like "g+w" or "g + w" into its bangs.
+func splitRefs(bangs string) []string {
+	refs := strings.Split(bangs, "+")
+	for i, ref := range refs {
+		refs[i] = strings.TrimSpace(ref)
+	}
+	return refs
+}
+
+// prepareInput splits input into its entries, the bang or alias as typed and the query.
+func (bl BangList) prepareInput(input string, aliases map[string]string, x *Explanation) ([]*Entry, string, string, error) {
 	entries := make([]*Entry, 0)
 	if !allowNoBang && len(input) < 2 {
-		return nil, "", fmt.Errorf("len(query) was smaller than 2, which is not valid")
+		return nil, "", "", fmt.Errorf("len(query) was smaller than 2, which is not valid")
 	}
 	if input[0] == ignoreChar[0] {
-		return nil, "", InputStartsWithIgnoreError(input)
+		x.step("ignore_char", "The input starts with the ignore character '%s', which is removed", ignoreChar[:1])
+		return nil, "", "", InputStartsWithIgnoreError(input)
 	}
 	bangOffset := 1
 	if input[0] != '!' {
 		if !allowNoBang {
-			return nil, "", InputHasNoBangError(input)
+			x.step("bang", "The input does not start with '!', so it has no bang")
+			return nil, "", "", InputHasNoBangError(input)
 		}
+		x.step("bang", "The input does not start with '!'; bangs without '!' are allowed, so the first word is tried as one")
 		bangOffset = 0
 	}
 
 	split := strings.SplitN(input[bangOffset:], " ", 2)
+	if len(split) != 2 {
+		x.step("bang", "The input is a single word, so it has no bang")
+	}
 	if !allowNoBang && len(split) != 2 {
-		return nil, "", fmt.Errorf("query does not contain a bang and a query")
+		return nil, "", "", fmt.Errorf("query does not contain a bang and a query")
 	}
 
 	var (
@@ -322,34 +652,38 @@ func (bl BangList) PrepareInput(input string) ([]*Entry, string, error) {
 		query = split[0]
 	} else {
 		rawBang, query = split[0], split[1]
+		x.step("bang", "The bang is '%s'", rawBang)
 	}
 
 	// Resolve alias if it exists
-	if alias, exists := registry.Aliases[rawBang]; exists {
+	target := rawBang
+	if alias, exists := aliases[rawBang]; exists {
 		slog.Debug("Resolved alias", "alias", rawBang, "target", alias)
-		rawBang = alias
+		x.step("alias", "'%s' is an alias for '%s'", rawBang, alias)
+		target = alias
 	}
 
-	bangs := make([]string, 0)
-	if strings.ContainsRune(rawBang, '+') {
-		bangs = strings.Split(rawBang, "+")
-	} else {
-		bangs = append(bangs, rawBang)
-	}
+	bangs := splitRefs(target)
 	slog.Debug("Parsed bangs", "bangs", bangs)
+	if len(bangs) > 1 {
+		x.step("multi_bang", "'%s' is a multi-bang and is split into %s", target, strings.Join(bangs, ", "))
+	}
 
 	for _, bang := range bangs {
 		entry, ok := bl.byBang[bang]
 		if !ok {
 			if allowNoBang {
-				return nil, "", InputHasNoBangError(input)
+				if rawBang != "" {
+					x.step("default", "'%s' is not a known bang or alias, so the whole input is the query", rawBang)
+				}
+				return nil, "", "", InputHasNoBangError(input)
 			}
 
-			return nil, "", fmt.Errorf("unknown bang: '%s'", bang)
+			return nil, "", "", UnknownBangError(bang)
 		}
 		entries = append(entries, &entry)
 	}
-	return entries, query, nil
+	return entries, rawBang, query, nil
 }
 
 // Benchmarked; lookup in precomputed map is faster even in smaller cases
@@ -377,8 +711,47 @@ func (bl BangList) PrepareInputNaive(input string) (*Entry, string, error) {
 
 // ListAllBangs returns the map of all loaded bang entries.
 func ListAllBangs() map[string]Entry {
-	if registry == nil {
+	reg := registry.Load()
+	if reg == nil {
 		return make(map[string]Entry) // Return empty map if not loaded
 	}
-	return registry.Entries.Entries
+	return reg.Entries.Entries
+}
+
+// ListedBangs returns the loaded entries that are not hidden from listings.
+func ListedBangs() map[string]Entry {
+	reg := registry.Load()
+	if reg == nil {
+		return make(map[string]Entry)
+	}
+	return reg.listedBangs()
+}
+
+func (r *Registry) listedBangs() map[string]Entry {
+	listed := make(map[string]Entry)
+	for name, entry := range r.Entries.Entries {
+		if !entry.Hidden {
+			listed[name] = entry
+		}
+	}
+	return listed
+}
+
+// ListedEntries returns the loaded entries not hidden from listings, in declaration order.
+func ListedEntries() []NamedEntry {
+	reg := registry.Load()
+	if reg == nil {
+		return nil
+	}
+	return reg.listedEntries()
+}
+
+func (r *Registry) listedEntries() []NamedEntry {
+	listed := make([]NamedEntry, 0, len(r.Entries.Entries))
+	for _, entry := range r.Entries.Ordered() {
+		if !entry.Hidden {
+			listed = append(listed, entry)
+		}
+	}
+	return listed
 }
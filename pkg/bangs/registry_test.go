@@ -1,6 +1,7 @@
 package bangs
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"math"
@@ -8,8 +9,12 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
 )
 
 var sizes = []int{10, 20, 100, 500, 1e3, 1e4, 5e4, 1e5, 5e5, 1e6, 5e6, 1e7, 5e7, 1e8}
@@ -192,8 +197,8 @@ func TestRegistry_DefaultForward(t *testing.T) {
 				if !strings.Contains(body, "window.open") {
 					t.Errorf("Expected multi-bang HTML with window.open, got: %s", body)
 				}
-				if !strings.Contains(body, "window.location.href") {
-					t.Errorf("Expected multi-bang HTML with window.location.href, got: %s", body)
+				if !strings.Contains(body, "window.location.replace") {
+					t.Errorf("Expected multi-bang HTML with window.location.replace, got: %s", body)
 				}
 			} else if tt.expectedURL != "" {
 				// For single redirects, check the Location header
@@ -255,9 +260,9 @@ func TestBangList_PrepareInput_WithAliases(t *testing.T) {
 	}
 
 	// Set the global registry for testing
-	oldRegistry := registry
-	registry = testRegistry
-	defer func() { registry = oldRegistry }()
+	oldRegistry := registry.Load()
+	registry.Store(testRegistry)
+	defer registry.Store(oldRegistry)
 
 	// Enable multi-bang for testing
 	oldAllowMultiBang := allowMultiBang
@@ -348,11 +353,11 @@ func TestLoad_ProjectRegistryIncludesKagiAsDefault(t *testing.T) {
 		t.Fatalf("failed to load project registry: %v", err)
 	}
 
-	if registry.Default != QueryURL("kagi") {
-		t.Fatalf("expected default bang to be kagi, got %q", registry.Default)
+	if registry.Load().Default != QueryURL("kagi") {
+		t.Fatalf("expected default bang to be kagi, got %q", registry.Load().Default)
 	}
 
-	entry, ok := registry.Entries.byBang["kagi"]
+	entry, ok := registry.Load().Entries.byBang["kagi"]
 	if !ok {
 		t.Fatal("expected Kagi bang to be present in project registry")
 	}
@@ -366,6 +371,113 @@ func TestLoad_ProjectRegistryIncludesKagiAsDefault(t *testing.T) {
 	}
 }
 
+func TestParse_FormatsAreEquivalent(t *testing.T) {
+	sources := map[Format]string{
+		FormatYAML: `
+default: 'g'
+aliases:
+  dev: 'gh+g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  description: 'Search Google'
+  category: 'Search'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+`,
+		FormatJSON: `{
+  "default": "g",
+  "aliases": {"dev": "gh+g"},
+  "Google": {"bang": "g", "url": "https://www.google.com/search?q={}", "description": "Search Google", "category": "Search"},
+  "GitHub": {"bang": "gh", "url": "https://github.com/search?q={}"}
+}`,
+		FormatTOML: `
+default = 'g'
+
+[aliases]
+dev = 'gh+g'
+
+[Google]
+bang = 'g'
+url = 'https://www.google.com/search?q={}'
+description = 'Search Google'
+category = 'Search'
+
+[GitHub]
+bang = 'gh'
+url = 'https://github.com/search?q={}'
+`,
+	}
+
+	for format, source := range sources {
+		t.Run(string(format), func(t *testing.T) {
+			reg, err := Parse([]byte(source), format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reg.Default != "g" {
+				t.Errorf("expected default 'g', got %q", reg.Default)
+			}
+			if reg.Aliases["dev"] != "gh+g" {
+				t.Errorf("expected alias dev -> gh+g, got %v", reg.Aliases)
+			}
+			want := Entry{Bang: "g", URL: "https://www.google.com/search?q={}", Description: "Search Google", Category: "Search", Icon: "https://www.google.com/favicon.ico"}
+			if got := reg.Entries.Entries["Google"]; !got.Equals(want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			if _, ok := reg.Entries.byBang["gh"]; !ok {
+				t.Errorf("expected gh to be indexed by bang")
+			}
+		})
+	}
+}
+
+func TestParse_SameErrorsForEveryFormat(t *testing.T) {
+	sources := map[Format]string{
+		FormatYAML: "A:\n  bang: 'x'\n  url: 'https://a/?q={}'\nB:\n  bang: 'x'\n  url: 'https://b/?q={}'\n",
+		FormatJSON: `{"A": {"bang": "x", "url": "https://a/?q={}"}, "B": {"bang": "x", "url": "https://b/?q={}"}}`,
+		FormatTOML: "[A]\nbang = 'x'\nurl = 'https://a/?q={}'\n[B]\nbang = 'x'\nurl = 'https://b/?q={}'\n",
+	}
+
+	for format, source := range sources {
+		_, err := Parse([]byte(source), format)
+		if err == nil || !strings.HasPrefix(err.Error(), "duplicate bang found for ") {
+			t.Errorf("%s: expected duplicate bang error, got %v", format, err)
+		}
+	}
+
+	for format, source := range map[Format]string{
+		FormatYAML: "A:\n  bang: 'x'\n",
+		FormatJSON: `{"A": {"bang": "x"}}`,
+		FormatTOML: "[A]\nbang = 'x'\n",
+	} {
+		_, err := Parse([]byte(source), format)
+		if err == nil || err.Error() != "missing url field for entry A" {
+			t.Errorf("%s: expected missing url error, got %v", format, err)
+		}
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]Format{
+		"bangs.yaml":      FormatYAML,
+		"bangs.yml":       FormatYAML,
+		"/etc/bangs.JSON": FormatJSON,
+		"conf/bangs.toml": FormatTOML,
+		"bangs":           FormatYAML,
+	}
+	for path, want := range tests {
+		if got := FormatFromPath(path); got != want {
+			t.Errorf("FormatFromPath(%q) = %q, expected %q", path, got, want)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
 func BenchmarkPrepareInputPreComp(b *testing.B) {
 	for _, size := range sizes {
 		bl := generateRandomBangs(size)
@@ -428,3 +540,736 @@ func BenchmarkPrepareInputNaive(b *testing.B) {
 		})
 	}
 }
+
+func TestRegistry_Validate(t *testing.T) {
+	reg, err := Parse([]byte(`
+default: 'g+nope'
+aliases:
+  dev: 'gh+missing'
+  g: 'gh'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	var got []string
+	for _, problem := range reg.Validate() {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		"alias 'dev' references unknown bang 'missing'",
+		"alias 'g' shadows the bang of the same name",
+		"default references unknown bang or alias 'nope'",
+		"url of entry 'GitHub' is invalid: no placeholder found in path, query, or fragment",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected problems:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRegistry_ValidAliasResolves(t *testing.T) {
+	SetOptions(false, true, ".")
+	defer SetOptions(false, false, ".")
+	reg, err := Parse([]byte(`
+default: 'both'
+aliases:
+  both: 'gh + g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := reg.Validate(); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+	want := []string{"https://github.com/search?q=a", "https://www.google.com/search?q=a"}
+	for _, input := range []string{"!both a", "##a"} {
+		urls, err := reg.Resolve(input)
+		if err != nil || !slices.Equal(urls, want) {
+			t.Errorf("%s: expected %v, got %v, %v", input, want, urls, err)
+		}
+	}
+}
+
+func TestRegistry_Validate_ProjectRegistry(t *testing.T) {
+	reg, err := ParseFile(filepath.Join("..", "..", "bangs.yaml"), "")
+	if err != nil {
+		t.Fatalf("failed to parse project registry: %v", err)
+	}
+	for _, problem := range reg.Validate() {
+		t.Errorf("project registry problem: %v", problem)
+	}
+}
+
+func TestSchema_IsValidJSON(t *testing.T) {
+	type object struct {
+		Properties map[string]any `json:"properties"`
+	}
+	var schema struct {
+		Then        object         `json:"then"`
+		Else        object         `json:"else"`
+		Definitions map[string]any `json:"definitions"`
+	}
+	err := json.Unmarshal(Schema, &schema)
+	if err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"version", "default", "aliases"} {
+		if _, ok := schema.Then.Properties[key]; !ok {
+			t.Errorf("version 2 schema does not describe %q", key)
+		}
+		if _, ok := schema.Else.Properties[key]; !ok {
+			t.Errorf("version 1 schema does not describe %q", key)
+		}
+	}
+	if _, ok := schema.Then.Properties["bangs"]; !ok {
+		t.Errorf("version 2 schema does not describe the bangs map")
+	}
+	if _, ok := schema.Definitions["entry"]; !ok {
+		t.Errorf("schema does not define entries")
+	}
+}
+
+func TestParse_Interpolation(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "tenant")
+	err := os.WriteFile(secret, []byte("acme-42\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BANGS_TEST_HOST", "jira.example.com")
+	t.Setenv("BANGS_TEST_DEFAULT", "j")
+
+	reg, err := Parse([]byte(`
+default: '${BANGS_TEST_DEFAULT}'
+aliases:
+  work: '${BANGS_TEST_DEFAULT}+g'
+Jira:
+  bang: 'j'
+  url: 'https://${BANGS_TEST_HOST}/t/${file:`+secret+`}/search?q={}&raw=$${literal}'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg.Default != "j" {
+		t.Errorf("expected default 'j', got %q", reg.Default)
+	}
+	if reg.Aliases["work"] != "j+g" {
+		t.Errorf("expected alias 'j+g', got %q", reg.Aliases["work"])
+	}
+	want := QueryURL("https://jira.example.com/t/acme-42/search?q={}&raw=${literal}")
+	if got := reg.Entries.Entries["Jira"].URL; got != want {
+		t.Errorf("expected url %q, got %q", want, got)
+	}
+
+	_, err = Parse([]byte("A:\n  bang: 'a'\n  url: 'https://${BANGS_TEST_UNDEFINED}/?q={}'\n"), FormatYAML)
+	if err == nil || err.Error() != "url of entry 'A': undefined environment variable 'BANGS_TEST_UNDEFINED'" {
+		t.Errorf("expected undefined variable error, got %v", err)
+	}
+
+	_, err = Parse([]byte("default: '${file:/nonexistent/secret}'\n"), FormatYAML)
+	if err == nil || !strings.HasPrefix(err.Error(), "default: reading secret file") {
+		t.Errorf("expected secret file error, got %v", err)
+	}
+}
+
+func TestParse_Version2(t *testing.T) {
+	reg, err := Parse([]byte(`
+version: 2
+default: 'default'
+aliases:
+  d: 'default'
+bangs:
+  default:
+    bang: 'default'
+    url: 'https://example.com/?q={}'
+  aliases:
+    bang: 'al'
+    url: 'https://aliases.example.com/?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg.Version != 2 {
+		t.Errorf("expected version 2, got %d", reg.Version)
+	}
+	if len(reg.Entries.Entries) != 2 {
+		t.Errorf("expected entries named default and aliases, got %v", reg.Entries.Entries)
+	}
+	if reg.Default != "default" || reg.Aliases["d"] != "default" {
+		t.Errorf("expected default and aliases to be read from the top level, got %q and %v", reg.Default, reg.Aliases)
+	}
+
+	legacy, err := Parse([]byte("version:\n  bang: 'v'\n  url: 'https://v.example.com/?q={}'\n"), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if legacy.Version != 1 || legacy.Entries.Entries["version"].Bang != "v" {
+		t.Errorf("expected an entry called version to keep a file at version 1, got %+v", legacy)
+	}
+
+	errorTests := map[string]string{
+		"version: 2\nGoogle:\n  bang: 'g'\n  url: 'https://google.com/?q={}'\n": "unknown top-level key 'Google' in version 2 registry, entries belong under 'bangs'",
+		"version: 3\n":                "unsupported registry version 3 (supported: 1 to 2)",
+		"version: 'two'\n":            "version must be an integer",
+		"version: 2\nbangs: 'none'\n": "bangs must be a map of entry name to entry",
+	}
+	for source, want := range errorTests {
+		_, err := Parse([]byte(source), FormatYAML)
+		if err == nil || err.Error() != want {
+			t.Errorf("expected error %q, got %v", want, err)
+		}
+	}
+}
+
+func TestParse_EntryMetadata(t *testing.T) {
+	reg, err := Parse([]byte(`
+default: 'g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  tags: ['web', 'general']
+  examples: ['weather berlin']
+  aliases: ['goog', ' gg ']
+Old Google:
+  bang: 'og'
+  url: 'https://old.example.com/?q={}'
+  icon: 'https://cdn.example.com/old.png'
+  hidden: true
+  replacement: 'g'
+NoIcon:
+  bang: 'ni'
+  url: 'https://noicon.example.com/?q={}'
+  icon: ''
+  deprecated: true
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	google := reg.Entries.Entries["Google"]
+	want := Entry{
+		Bang:     "g",
+		URL:      "https://www.google.com/search?q={}",
+		Tags:     []string{"web", "general"},
+		Icon:     "https://www.google.com/favicon.ico",
+		Examples: []string{"weather berlin"},
+		Aliases:  []string{"goog", "gg"},
+	}
+	if !google.Equals(want) {
+		t.Errorf("expected %+v, got %+v", want, google)
+	}
+	for _, bang := range []string{"g", "goog", "gg"} {
+		if reg.Entries.byBang[bang].Bang != "g" {
+			t.Errorf("expected %q to resolve to Google", bang)
+		}
+	}
+
+	old := reg.Entries.Entries["Old Google"]
+	if !old.Hidden || !old.Deprecated || old.Replacement != "g" || old.Icon != "https://cdn.example.com/old.png" {
+		t.Errorf("unexpected metadata for Old Google: %+v", old)
+	}
+	noIcon := reg.Entries.Entries["NoIcon"]
+	if noIcon.Icon != "" || !noIcon.Deprecated {
+		t.Errorf("unexpected metadata for NoIcon: %+v", noIcon)
+	}
+
+	errorTests := map[string]string{
+		"A:\n  bang: 'a'\n  url: 'https://a/?q={}'\n  aliases: ['b']\nB:\n  bang: 'b'\n  url: 'https://b/?q={}'\n": "duplicate bang found for ",
+		"A:\n  bang: 'a'\n  url: 'https://a/?q={}'\n  tags: 'web'\n":                                               "field 'tags' of entry 'A' must be a list of strings",
+		"A:\n  bang: 'a'\n  url: 'https://a/?q={}'\n  hidden: 'yes'\n":                                             "field 'hidden' of entry 'A' must be true or false",
+	}
+	for source, want := range errorTests {
+		_, err := Parse([]byte(source), FormatYAML)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("expected error starting with %q, got %v", want, err)
+		}
+	}
+
+	reg, err = Parse([]byte("default: 'a'\nA:\n  bang: 'a'\n  url: 'https://a/?q={}'\n  replacement: 'nope'\n"), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := reg.Validate()
+	if len(problems) != 1 || problems[0].Error() != "replacement of entry 'A' references unknown bang 'nope'" {
+		t.Errorf("expected unknown replacement problem, got %v", problems)
+	}
+}
+
+func TestSearchByQuery_EntryMetadata(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	reg, err := Parse([]byte(`
+default: 'g'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  aliases: ['goog']
+Old Google:
+  bang: 'og'
+  url: 'https://old.example.com/?q={}'
+  hidden: true
+  replacement: 'g'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+	handler := Handler(false, false, ".")
+
+	req := httptest.NewRequest("GET", "/?q=!goog+test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://www.google.com/search?q=test" {
+		t.Errorf("expected inline alias to redirect to Google, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest("GET", "/?q=!og+test", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected deprecation notice, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"!og</strong> is deprecated", "use <strong>!g</strong> instead", `content="3;url=https://old.example.com/?q=test"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected notice to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/list", nil)
+	w = httptest.NewRecorder()
+	middleware.SecurityHeaders(handler).ServeHTTP(w, req)
+	var list struct {
+		Bangs map[string]Entry `json:"bangs"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := list.Bangs["Old Google"]; ok {
+		t.Errorf("expected hidden entry to be left out of /list")
+	}
+	if got := list.Bangs["Google"]; got.Icon != "https://www.google.com/favicon.ico" || len(got.Aliases) != 1 {
+		t.Errorf("expected metadata in /list, got %+v", got)
+	}
+	if policy := w.Header().Get("Content-Security-Policy"); !strings.Contains(policy, "img-src 'self' data: https:;") {
+		t.Errorf("expected the policy to let the web UI show the icons of /list, got %s", policy)
+	}
+}
+
+func TestParse_DeclarationOrder(t *testing.T) {
+	sources := map[Format]string{
+		FormatYAML: `
+default: 'z'
+# ===== Search =====
+Zeta:
+  bang: 'z'
+  url: 'https://z.example.com/?q={}'
+# plain comment, not a section
+Alpha:
+  bang: 'a'
+  url: 'https://a.example.com/?q={}'
+
+# ====================
+# Development
+# ====================
+Mid:
+  bang: 'm'
+  url: 'https://m.example.com/?q={}'
+`,
+		FormatJSON: `{"default": "z", "Zeta": {"bang": "z", "url": "https://z.example.com/?q={}", "category": "Search"}, "Alpha": {"bang": "a", "url": "https://a.example.com/?q={}", "category": "Search"}, "Mid": {"bang": "m", "url": "https://m.example.com/?q={}", "category": "Development"}}`,
+		FormatTOML: `
+version = 2
+default = 'z'
+[bangs.Zeta]
+bang = 'z'
+url = 'https://z.example.com/?q={}'
+category = 'Search'
+[bangs.Alpha]
+bang = 'a'
+url = 'https://a.example.com/?q={}'
+category = 'Search'
+[bangs]
+Mid = { bang = 'm', url = 'https://m.example.com/?q={}', category = 'Development' }
+`,
+	}
+
+	for format, source := range sources {
+		t.Run(string(format), func(t *testing.T) {
+			reg, err := Parse([]byte(source), format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, e := range reg.Entries.Ordered() {
+				got = append(got, e.Name+"/"+e.Section)
+			}
+			want := []string{"Zeta/Search", "Alpha/Search", "Mid/Development"}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestListAll_Ordered(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	err := Load("../../bangs.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler(true, false, ".")
+
+	var first []string
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/list", nil))
+		var list struct {
+			Bangs   map[string]Entry `json:"bangs"`
+			Entries []NamedEntry     `json:"entries"`
+		}
+		err = json.Unmarshal(w.Body.Bytes(), &list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Entries) != len(list.Bangs) {
+			t.Fatalf("expected ordered entries to match the map, got %d and %d", len(list.Entries), len(list.Bangs))
+		}
+		var names []string
+		for _, e := range list.Entries {
+			names = append(names, e.Name)
+		}
+		if first == nil {
+			first = names
+		} else if strings.Join(first, ",") != strings.Join(names, ",") {
+			t.Fatalf("expected stable order between requests")
+		}
+	}
+	if list := registry.Load().Entries.Ordered(); list[0].Name != "Google" || list[0].Section != "Search Engines" {
+		t.Errorf("expected Google in Search Engines first, got %+v", list[0])
+	}
+}
+
+func TestParse_Extends(t *testing.T) {
+	reg, err := Parse([]byte(`
+version: 2
+default: 'gho'
+bangs:
+  GitHub Search:
+    template: true
+    url: 'https://github.com/search?q={}'
+    description: 'Search GitHub'
+    category: 'Development'
+    tags: ['code']
+  GitHub Org:
+    extends: 'GitHub Search'
+    bang: 'gho'
+    url: 'https://github.com/search?q=org:dikkadev+{}'
+  GitHub Org Issues:
+    extends: 'GitHub Org'
+    bang: 'ghi'
+    description: 'Search issues of the org'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := reg.Entries.Entries["GitHub Search"]; ok {
+		t.Errorf("expected template not to be an entry")
+	}
+	if len(reg.Entries.byBang) != 2 {
+		t.Errorf("expected only gho and ghi to be bangs, got %v", reg.Entries.byBang)
+	}
+
+	issues := reg.Entries.Entries["GitHub Org Issues"]
+	want := Entry{
+		Bang:        "ghi",
+		URL:         "https://github.com/search?q=org:dikkadev+{}",
+		Description: "Search issues of the org",
+		Category:    "Development",
+		Tags:        []string{"code"},
+		Icon:        "https://github.com/favicon.ico",
+		Extends:     "GitHub Org",
+	}
+	if !issues.Equals(want) {
+		t.Errorf("expected %+v, got %+v", want, issues)
+	}
+
+	errorTests := map[string]string{
+		"A:\n  extends: 'Nope'\n  bang: 'a'\n": "entry 'A' extends unknown entry 'Nope'",
+		"A:\n  extends: 'B'\n  bang: 'a'\nB:\n  extends: 'C'\n  template: true\nC:\n  extends: 'A'\n  template: true\n": "inheritance cycle: ",
+		"A:\n  template: 'yes'\n": "field 'template' of entry 'A' must be true or false",
+	}
+	for source, want := range errorTests {
+		_, err := Parse([]byte(source), FormatYAML)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("expected error starting with %q, got %v", want, err)
+		}
+	}
+}
+
+func TestParse_Matrix(t *testing.T) {
+	reg, err := Parse([]byte(`
+default: 'wen'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+Wikipedia:
+  matrix:
+    lang: ['en', 'de', 'fr']
+  bang: 'w{{lang}}'
+  url: 'https://{{lang}}.wikipedia.org/w/index.php?search={}'
+  description: 'Wikipedia in {{lang}}'
+  category: 'Reference'
+Docs {{site}} {{v}}:
+  matrix:
+    site: ['go']
+    v: [1, 2]
+  bang: 'd{{site}}{{v}}'
+  url: 'https://{{site}}.example.com/v{{v}}/?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	de := reg.Entries.Entries["Wikipedia (de)"]
+	want := Entry{
+		Bang:        "wde",
+		URL:         "https://de.wikipedia.org/w/index.php?search={}",
+		Description: "Wikipedia in de",
+		Category:    "Reference",
+		Icon:        "https://de.wikipedia.org/favicon.ico",
+		Template:    "Wikipedia",
+	}
+	if !de.Equals(want) {
+		t.Errorf("expected %+v, got %+v", want, de)
+	}
+	if _, ok := reg.Entries.Entries["Wikipedia"]; ok {
+		t.Errorf("expected the matrix entry itself not to be an entry")
+	}
+	if reg.Entries.byBang["dgo2"].URL != "https://go.example.com/v2/?q={}" {
+		t.Errorf("expected substituted names and numbers, got %v", reg.Entries.Entries)
+	}
+
+	var names []string
+	for _, e := range reg.Entries.Ordered() {
+		names = append(names, e.Name)
+	}
+	wantNames := "Google,Wikipedia (en),Wikipedia (de),Wikipedia (fr),Docs go 1,Docs go 2"
+	if strings.Join(names, ",") != wantNames {
+		t.Errorf("expected order %s, got %v", wantNames, names)
+	}
+
+	nested, err := Parse([]byte("W:\n  matrix: {a: ['{{b}}'], b: [x]}\n  bang: 'w{{a}}'\n  url: 'https://{{a}}/?q={}'\n"), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := nested.Entries.byBang["wx"]; !ok {
+		t.Errorf("expected variables to be replaced in name order, got %v", nested.Entries.Entries)
+	}
+
+	values := "[0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10]"
+	errorTests := map[string]string{
+		"A:\n  bang: 'wen'\n  url: 'https://a/?q={}'\nW:\n  matrix: {lang: [en]}\n  bang: 'w{{lang}}'\n  url: 'https://{{lang}}/?q={}'\n": "duplicate bang found for ",
+		"W:\n  matrix: {lang: [en, en]}\n  bang: 'w{{lang}}'\n  url: 'https://{{lang}}/?q={}'\n":                                          "entry 'W (en)' generated by the matrix of 'W' already exists",
+		"W:\n  matrix: {lang: []}\n  bang: 'w'\n  url: 'https://w/?q={}'\n":                                                               "matrix variable 'lang' of entry 'W' must be a non-empty list",
+		"W:\n  matrix: ['en']\n  bang: 'w'\n  url: 'https://w/?q={}'\n":                                                                   "matrix of entry 'W' must map variable names to lists of values",
+		"W:\n  matrix: {a: " + values + ", b: " + values + ", c: " + values + "}\n  bang: 'w{{a}}{{b}}{{c}}'\n  url: 'https://w/?q={}'\n": "matrix of entry 'W' has more than 1000 combinations",
+	}
+	for source, want := range errorTests {
+		_, err := Parse([]byte(source), FormatYAML)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("expected error starting with %q, got %v", want, err)
+		}
+	}
+}
+
+func TestRegistry_RunTests(t *testing.T) {
+	SetOptions(false, false, ".")
+	reg, err := Parse([]byte(`
+version: 2
+default: 'g'
+aliases:
+  dev:
+    target: 'gh+g'
+    tests:
+      - input: '!dev foo'
+        expect: ['https://github.com/search?q=foo', 'https://www.google.com/search?q=foo']
+bangs:
+  Google:
+    bang: 'g'
+    url: 'https://www.google.com/search?q={}'
+    tests:
+      - input: 'no bang'
+        expect: 'https://www.google.com/search?q=no+bang'
+      - input: '!g foo'
+        expect: 'https://www.google.com/search?q=bar'
+  GitHub:
+    bang: 'gh'
+    url: 'https://github.com/search?q={}'
+    tests:
+      - input: '!gh foo bar'
+        expect: 'https://github.com/search?q=foo+bar'
+  Wikipedia:
+    matrix:
+      lang: ['en', 'de']
+    bang: 'w{{lang}}'
+    url: 'https://{{lang}}.wikipedia.org/w/index.php?search={}'
+    tests:
+      - input: '!w{{lang}} go'
+        expect: 'https://{{lang}}.wikipedia.org/w/index.php?search=go'
+      - input: '!unknown go'
+        expect: 'https://example.com'
+`), FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg.Aliases["dev"] != "gh+g" {
+		t.Errorf("expected the alias target to be read from the map, got %q", reg.Aliases["dev"])
+	}
+	if n := reg.NumTests(); n != 8 {
+		t.Errorf("expected 8 tests, got %d", n)
+	}
+
+	failures := reg.RunTests()
+	if len(failures) != 3 {
+		t.Fatalf("expected 3 failures, got %d: %v", len(failures), failures)
+	}
+	want := "entry 'Google': !g foo\n- https://www.google.com/search?q=bar\n+ https://www.google.com/search?q=foo\n"
+	if got := failures[0].String(); got != want {
+		t.Errorf("expected diff\n%s\ngot\n%s", want, got)
+	}
+	for _, failure := range failures[1:] {
+		if failure.Input != "!unknown go" || failure.Err == nil {
+			t.Errorf("expected the unknown bang to fail with an error, got %v", failure)
+		}
+	}
+	if !strings.Contains(failures[1].String(), "+ error: unknown bang: 'unknown'") {
+		t.Errorf("expected the error in the diff, got %s", failures[1])
+	}
+
+	_, err = Parse([]byte(`
+G:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  tests:
+    - input: '!g foo'
+`), FormatYAML)
+	if err == nil || !strings.Contains(err.Error(), "test 1 of 'G'") {
+		t.Errorf("expected an error for a test without expect, got %v", err)
+	}
+}
+
+func TestLoad_Status(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bangs.yaml")
+	err := os.WriteFile(path, []byte("G:\n  bang: 'g'\n  url: 'https://www.google.com/search?q={}'\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := CurrentStatus()
+	if err := Load(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loaded := CurrentStatus()
+	if loaded.Generation != before.Generation+1 || loaded.Entries != 1 || loaded.Source != path || loaded.LastError != "" || loaded.LoadedAt.IsZero() {
+		t.Errorf("unexpected status after loading: %+v", loaded)
+	}
+
+	err = os.WriteFile(path, []byte("G: ["), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err == nil {
+		t.Fatal("expected an error for a broken file")
+	}
+	failed := CurrentStatus()
+	if failed.Generation != loaded.Generation || failed.LoadedAt != loaded.LoadedAt || failed.LastError == "" {
+		t.Errorf("expected the failed reload to keep the loaded registry and record the error, got %+v", failed)
+	}
+}
+
+func TestSearchByQuery_Metrics(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+
+	reg, err := Parse([]byte(`
+default: 'g'
+aliases:
+  both: 'g+gh'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+	handler := Handler(false, false, ".")
+
+	metrics := func() string {
+		var sb strings.Builder
+		if err := middleware.DefaultRegistry.Write(&sb); err != nil {
+			t.Fatal(err)
+		}
+		return sb.String()
+	}
+	value := func(body, series string) float64 {
+		for _, line := range strings.Split(body, "\n") {
+			if v, ok := strings.CutPrefix(line, series+" "); ok {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return f
+			}
+		}
+		return 0
+	}
+	series := []string{
+		`bangs_requests_total{outcome="bang",error=""}`,
+		`bangs_requests_total{outcome="alias",error=""}`,
+		`bangs_requests_total{outcome="default",error=""}`,
+		`bangs_requests_total{outcome="ignore",error=""}`,
+		`bangs_requests_total{outcome="error",error="unknown_bang"}`,
+		`bangs_requests_total{outcome="error",error="no_query"}`,
+		`bangs_bang_hits_total{bang="gh"}`,
+		`bangs_multi_bang_tabs_count`,
+	}
+	before := metrics()
+
+	for _, q := range []string{"!gh+test", "!both+test", "test", ".test", "!unknown+test", ""} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q="+q, nil))
+	}
+
+	after := metrics()
+	want := []float64{1, 1, 1, 1, 1, 1, 2, 1}
+	for i, s := range series {
+		if got := value(after, s) - value(before, s); got != want[i] {
+			t.Errorf("expected %s to grow by %v, got %v", s, want[i], got)
+		}
+	}
+	if strings.Contains(after, "test") {
+		t.Errorf("expected queries not to appear in metrics")
+	}
+}
@@ -0,0 +1,296 @@
+package bangs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dayFormat is the layout of the per-day usage counts.
+const dayFormat = "2006-01-02"
+
+// UsageStats counts the daily uses of each bang, globally across profiles and users, in a local file.
+type UsageStats struct {
+	mu        sync.Mutex
+	path      string
+	retention int
+	bangs     map[string]*bangUsage
+	dirty     bool
+	// totals holds the use count of every bang since pruned, the first day within the retention.
+	totals map[string]int
+	pruned string
+}
+
+type bangUsage struct {
+	LastUsed time.Time      `json:"lastUsed"`
+	Days     map[string]int `json:"days"`
+}
+
+type usageFile struct {
+	Version int                   `json:"version"`
+	Bangs   map[string]*bangUsage `json:"bangs"`
+}
+
+// usage records searches when usage statistics are enabled, see SetUsageStats.
+var usage *UsageStats
+
+// SetUsageStats makes searches count towards s. A nil s disables counting.
+func SetUsageStats(s *UsageStats) {
+	usage = s
+}
+
+// OpenUsageStats reads the usage file at path, which may not exist yet, keeping retentionDays days.
+func OpenUsageStats(path string, retentionDays int) (*UsageStats, error) {
+	if retentionDays < 1 {
+		return nil, fmt.Errorf("usage retention must be at least one day, got %d", retentionDays)
+	}
+	s := &UsageStats{path: path, retention: retentionDays, bangs: make(map[string]*bangUsage), totals: make(map[string]int)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file usageFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("reading usage file %s: %w", path, err)
+	}
+	for bang, u := range file.Bangs {
+		if u != nil && u.Days != nil {
+			s.bangs[bang] = u
+			for _, n := range u.Days {
+				s.totals[bang] += n
+			}
+		}
+	}
+	s.prune(time.Now())
+	return s, nil
+}
+
+// Record counts a use of bang at the given time, ignoring uses before the retention.
+func (s *UsageStats) Record(bang string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := at.Format(dayFormat)
+	if day < s.pruned {
+		return
+	}
+	u, ok := s.bangs[bang]
+	if !ok {
+		u = &bangUsage{Days: make(map[string]int)}
+		s.bangs[bang] = u
+	}
+	u.Days[day]++
+	s.totals[bang]++
+	if at.After(u.LastUsed) {
+		u.LastUsed = at
+	}
+	s.dirty = true
+}
+
+// since returns the first day within the retention.
+func (s *UsageStats) since(now time.Time) string {
+	return now.AddDate(0, 0, -(s.retention - 1)).Format(dayFormat)
+}
+
+// prune drops the days older than the retention; the caller must hold s.mu or own s.
+func (s *UsageStats) prune(now time.Time) {
+	since := s.since(now)
+	if since == s.pruned {
+		return
+	}
+	s.pruned = since
+	for bang, u := range s.bangs {
+		for day, n := range u.Days {
+			if day < since {
+				delete(u.Days, day)
+				s.totals[bang] -= n
+				s.dirty = true
+			}
+		}
+		if len(u.Days) == 0 {
+			delete(s.bangs, bang)
+			delete(s.totals, bang)
+		}
+	}
+}
+
+// Save atomically writes the counts to the usage file if they changed.
+func (s *UsageStats) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(usageFile{Version: 1, Bangs: s.bangs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// SaveEvery saves the counts at every interval until ctx is done.
+func (s *UsageStats) SaveEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.Save()
+			if err != nil {
+				slog.Error("Error saving usage statistics", "file", s.path, "err", err)
+			}
+		}
+	}
+}
+
+// Counts returns the use count of every bang used within the retention.
+func (s *UsageStats) Counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	return maps.Clone(s.totals)
+}
+
+// BangUsage is the usage of one entry within the retention.
+type BangUsage struct {
+	Name     string     `json:"name"`
+	Bang     string     `json:"bang"`
+	Category string     `json:"category,omitempty"`
+	Count    int        `json:"count"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// CategoryUsage is the summed usage of the entries of a category.
+type CategoryUsage struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// UsageReport summarizes the usage of the entries of a registry.
+type UsageReport struct {
+	RetentionDays int    `json:"retentionDays"`
+	Since         string `json:"since"`
+	// Top are the most used entries, Unused the unused listed ones in declaration order.
+	Top        []BangUsage     `json:"top"`
+	Unused     []BangUsage     `json:"unused"`
+	Categories []CategoryUsage `json:"categories"`
+	// Counts holds the use count of every used entry by name.
+	Counts map[string]int `json:"counts"`
+}
+
+// Report summarizes the usage of entries, listing at most limit top entries.
+func (s *UsageStats) Report(entries []NamedEntry, limit int) UsageReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	since := s.pruned
+
+	report := UsageReport{
+		RetentionDays: s.retention,
+		Since:         since,
+		Top:           []BangUsage{},
+		Unused:        []BangUsage{},
+		Categories:    []CategoryUsage{},
+		Counts:        make(map[string]int),
+	}
+	var used []BangUsage
+	byCategory := make(map[string]int)
+	var categories []string
+	for _, entry := range entries {
+		item := BangUsage{Name: entry.Name, Bang: entry.Bang, Category: entry.Category}
+		if u, ok := s.bangs[entry.Bang]; ok {
+			item.Count = s.totals[entry.Bang]
+			if item.Count > 0 {
+				lastUsed := u.LastUsed
+				item.LastUsed = &lastUsed
+			}
+		}
+		if _, seen := byCategory[entry.Category]; !seen {
+			categories = append(categories, entry.Category)
+		}
+		byCategory[entry.Category] += item.Count
+		if item.Count == 0 {
+			report.Unused = append(report.Unused, item)
+			continue
+		}
+		used = append(used, item)
+		report.Counts[entry.Name] = item.Count
+	}
+
+	sort.SliceStable(used, func(i, j int) bool {
+		return used[i].Count > used[j].Count
+	})
+	if limit > 0 && len(used) > limit {
+		used = used[:limit]
+	}
+	report.Top = append(report.Top, used...)
+
+	for _, category := range categories {
+		if category != "" && byCategory[category] > 0 {
+			report.Categories = append(report.Categories, CategoryUsage{Category: category, Count: byCategory[category]})
+		}
+	}
+	sort.SliceStable(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Count > report.Categories[j].Count
+	})
+	return report
+}
+
+// StatsHandler serves the usage report of the listed entries.
+func StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := usage
+		if stats == nil {
+			http.Error(w, "Usage statistics are disabled, set a stats file to enable them", http.StatusNotFound)
+			return
+		}
+		limit := 10
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("Invalid limit '%s'", l), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		var entries []NamedEntry
+		if reg := RequestRegistry(r); reg != nil {
+			entries = reg.listedEntries()
+		}
+		writeJSON(w, http.StatusOK, stats.Report(entries, limit))
+	})
+}
@@ -0,0 +1,137 @@
+package bangs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStats_SaveAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	stats, err := OpenUsageStats(path, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	stats.Record("gh", now)
+	stats.Record("gh", now.AddDate(0, 0, -1))
+	stats.Record("g", now.AddDate(0, 0, -40))
+	if err := stats.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reopened, err := OpenUsageStats(path, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := reopened.bangs["g"]; ok {
+		t.Errorf("expected usage older than the retention to be dropped")
+	}
+	if u := reopened.bangs["gh"]; u == nil || len(u.Days) != 2 || !u.LastUsed.Equal(now) {
+		t.Errorf("expected gh usage to survive a restart, got %+v", u)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %v", entries)
+	}
+
+	if counts := reopened.Counts(); len(counts) != 1 || counts["gh"] != 2 {
+		t.Errorf("expected only the uses of gh within the retention to count, got %v", counts)
+	}
+	reopened.Record("gh", now)
+	if counts := reopened.Counts(); counts["gh"] != 3 {
+		t.Errorf("expected a new use to count, got %v", counts)
+	}
+	reopened.mu.Lock()
+	reopened.prune(now.AddDate(0, 0, 30))
+	reopened.mu.Unlock()
+	if len(reopened.totals) != 0 {
+		t.Errorf("expected the counts to drop with their days, got %v", reopened.totals)
+	}
+
+	if _, err := OpenUsageStats(path, 0); err == nil {
+		t.Errorf("expected an error for a retention below one day")
+	}
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := OpenUsageStats(path, 30); err == nil {
+		t.Errorf("expected an error for a broken usage file")
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	defer SetUsageStats(nil)
+
+	reg, err := Parse([]byte(`
+aliases:
+  code: 'gh'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+  category: 'Search'
+GitHub:
+  bang: 'gh'
+  url: 'https://github.com/search?q={}'
+  category: 'Development'
+GitLab:
+  bang: 'gl'
+  url: 'https://gitlab.com/search?search={}'
+  category: 'Development'
+Secret:
+  bang: 's'
+  url: 'https://example.com/?q={}'
+  hidden: true
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+
+	w := httptest.NewRecorder()
+	StatsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 while statistics are disabled, got %d", w.Code)
+	}
+
+	stats, err := OpenUsageStats(filepath.Join(t.TempDir(), "stats.json"), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetUsageStats(stats)
+	handler := Handler(false, false, ".")
+	for _, q := range []string{"!gh+a", "!code+b", "!g+c", "!unknown+d", "!s+e"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q="+q, nil))
+	}
+
+	w = httptest.NewRecorder()
+	StatsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats?limit=1", nil))
+	var report UsageReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("unexpected response %d %s: %v", w.Code, w.Body, err)
+	}
+	if len(report.Top) != 1 || report.Top[0].Name != "GitHub" || report.Top[0].Count != 2 || report.Top[0].LastUsed == nil {
+		t.Errorf("expected GitHub used twice as the top entry, got %+v", report.Top)
+	}
+	if len(report.Unused) != 1 || report.Unused[0].Name != "GitLab" {
+		t.Errorf("expected only GitLab to be unused (hidden entries are not listed), got %+v", report.Unused)
+	}
+	wantCategories := []CategoryUsage{{"Development", 2}, {"Search", 1}}
+	if len(report.Categories) != 2 || report.Categories[0] != wantCategories[0] || report.Categories[1] != wantCategories[1] {
+		t.Errorf("expected %v, got %v", wantCategories, report.Categories)
+	}
+	if report.Counts["Google"] != 1 || report.Counts["GitHub"] != 2 {
+		t.Errorf("unexpected counts %v", report.Counts)
+	}
+
+	w = httptest.NewRecorder()
+	StatsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats?limit=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", w.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package bangs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TestCase is an example search and the URLs it must resolve to, one per bang.
+type TestCase struct {
+	Input  string   `yaml:"input" json:"input"`
+	Expect []string `yaml:"expect" json:"expect"`
+}
+
+func (tc TestCase) equals(other TestCase) bool {
+	return tc.Input == other.Input && slices.Equal(tc.Expect, other.Expect)
+}
+
+// TestFailure is a test case that resolved to something else than expected.
+type TestFailure struct {
+	// Name is the entry or alias that declared the test.
+	Name string
+	TestCase
+	Got []string
+	Err error
+}
+
+// String describes the failure as a diff of the expected and resolved URLs.
+func (f TestFailure) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n", f.Name, f.Input)
+	for _, u := range f.Expect {
+		fmt.Fprintf(&sb, "- %s\n", u)
+	}
+	if f.Err != nil {
+		fmt.Fprintf(&sb, "+ error: %v\n", f.Err)
+	}
+	for _, u := range f.Got {
+		fmt.Fprintf(&sb, "+ %s\n", u)
+	}
+	return sb.String()
+}
+
+// NumTests returns how many test cases the registry declares.
+func (r *Registry) NumTests() int {
+	n := 0
+	for _, entry := range r.Entries.Entries {
+		n += len(entry.Tests)
+	}
+	for _, tests := range r.AliasTests {
+		n += len(tests)
+	}
+	return n
+}
+
+// RunTests returns the test cases that do not resolve to the expected URLs.
+func (r *Registry) RunTests() []TestFailure {
+	var failures []TestFailure
+	run := func(name string, tests []TestCase) {
+		for _, tc := range tests {
+			got, err := r.Resolve(tc.Input)
+			if err != nil || !slices.Equal(got, tc.Expect) {
+				failures = append(failures, TestFailure{Name: name, TestCase: tc, Got: got, Err: err})
+			}
+		}
+	}
+	for _, entry := range r.Entries.Ordered() {
+		run(fmt.Sprintf("entry '%s'", entry.Name), entry.Tests)
+	}
+	for _, alias := range sortedKeys(r.AliasTests) {
+		run(fmt.Sprintf("alias '%s'", alias), r.AliasTests[alias])
+	}
+	return failures
+}
+
+// readTests reads the tests of an entry or alias; expect may be a URL or a list.
+func readTests(raw any, name string) ([]TestCase, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("tests of '%s' must be a list", name)
+	}
+	tests := make([]TestCase, 0, len(items))
+	for i, item := range items {
+		m, _ := item.(map[string]any)
+		input, _ := m["input"].(string)
+		var expect []string
+		switch e := m["expect"].(type) {
+		case string:
+			expect = []string{e}
+		case []any:
+			for _, u := range e {
+				str, ok := u.(string)
+				if !ok {
+					expect = nil
+					break
+				}
+				expect = append(expect, str)
+			}
+		}
+		if input == "" || len(expect) == 0 {
+			return nil, fmt.Errorf("test %d of '%s' needs an input and an expected URL", i+1, name)
+		}
+		tests = append(tests, TestCase{Input: input, Expect: expect})
+	}
+	return tests, nil
+}
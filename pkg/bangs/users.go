@@ -0,0 +1,486 @@
+package bangs
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookie is the cookie that keeps a user logged in after a login.
+const SessionCookie = "bangs_session"
+
+// sessionDuration is how long a login lasts.
+const sessionDuration = 30 * 24 * time.Hour
+
+// verifiedDuration is how long checked basic credentials skip bcrypt and the check limit.
+const verifiedDuration = 5 * time.Minute
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+type userKey struct{}
+
+// RequestUser returns the user of a request, or "" if it has none.
+func RequestUser(r *http.Request) string {
+	name, _ := r.Context().Value(userKey{}).(string)
+	return name
+}
+
+// Users are the accounts of an instance, each with an optional overlay over the shared registry.
+type Users struct {
+	mu           sync.Mutex
+	passwordFile string
+	passwords    map[string]string
+	// tokens maps static tokens to their user.
+	tokens     map[string]string
+	overlayDir string
+	overlays   map[string]*Registry
+	// merged caches the overlays layered over the registry they were last merged with.
+	merged map[string]mergedOverlay
+	key    []byte
+	// limiter bounds the password checks per client; verified holds the last successful checks.
+	limiter  *middleware.RateLimiter
+	verified map[string]time.Time
+}
+
+type mergedOverlay struct {
+	base, merged *Registry
+}
+
+// NewUsers reads the accounts from a bcrypt htpasswd file and static tokens, with overlays from overlayDir.
+func NewUsers(passwordFile string, tokens map[string]string, overlayDir string, key []byte) (*Users, error) {
+	u := &Users{
+		passwordFile: passwordFile,
+		passwords:    make(map[string]string),
+		tokens:       make(map[string]string, len(tokens)),
+		overlayDir:   overlayDir,
+		overlays:     make(map[string]*Registry),
+		key:          key,
+	}
+	if len(u.key) == 0 {
+		u.key = make([]byte, 32)
+		rand.Read(u.key)
+	}
+	for name, token := range tokens {
+		if !userNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid user name '%s'", name)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("empty token for user '%s'", name)
+		}
+		u.tokens[token] = name
+	}
+	err := u.LoadPasswords()
+	if err != nil {
+		return nil, err
+	}
+	err = u.LoadOverlays()
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// LoadPasswords reads the htpasswd file again.
+func (u *Users) LoadPasswords() error {
+	if u.passwordFile == "" {
+		return nil
+	}
+	passwords, err := readHtpasswd(u.passwordFile)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	u.passwords = passwords
+	u.verified = nil
+	u.mu.Unlock()
+	slog.Info("Loaded users", "file", u.passwordFile, "N", len(passwords))
+	return nil
+}
+
+func readHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok || !userNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%s line %d: expected name:hash", path, n)
+		}
+		if !strings.HasPrefix(hash, "$2") {
+			return nil, fmt.Errorf("%s line %d: unsupported hash for user '%s', use bcrypt (htpasswd -B)", path, n, name)
+		}
+		passwords[name] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// checkPassword reports whether password matches the htpasswd hash.
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// LoadOverlays reads the overlay registries of the known users again.
+func (u *Users) LoadOverlays() error {
+	if u.overlayDir == "" {
+		return nil
+	}
+	files, err := os.ReadDir(u.overlayDir)
+	if err != nil {
+		return err
+	}
+	overlays := make(map[string]*Registry)
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		name := strings.TrimSuffix(file.Name(), ext)
+		if file.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch strings.ToLower(ext) {
+		case ".yaml", ".yml", ".json", ".toml":
+		default:
+			continue
+		}
+		if !u.exists(name) {
+			slog.Warn("Skipping overlay of unknown user", "file", file.Name())
+			continue
+		}
+		path := filepath.Join(u.overlayDir, file.Name())
+		reg, err := ParseFile(path, "")
+		if err != nil {
+			return fmt.Errorf("overlay %s: %w", path, err)
+		}
+		overlays[name] = reg
+	}
+	u.mu.Lock()
+	u.overlays = overlays
+	u.merged = nil
+	u.mu.Unlock()
+	slog.Info("Loaded user overlays", "dir", u.overlayDir, "N", len(overlays))
+	return nil
+}
+
+// exists reports whether name is a user.
+func (u *Users) exists(name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.passwords[name]; ok {
+		return true
+	}
+	for _, user := range u.tokens {
+		if user == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry returns the overlay of a user layered over base, or base if there is none.
+func (u *Users) Registry(name string, base *Registry) *Registry {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	overlay, ok := u.overlays[name]
+	if !ok || base == nil {
+		return base
+	}
+	if u.merged == nil {
+		u.merged = make(map[string]mergedOverlay)
+	}
+	m, ok := u.merged[name]
+	if !ok || m.base != base {
+		m = mergedOverlay{base: base, merged: base.Overlay(overlay)}
+		u.merged[name] = m
+	}
+	return m.merged
+}
+
+// LimitPasswordChecks charges every password check not verified recently to l.
+func (u *Users) LimitPasswordChecks(l *middleware.RateLimiter) {
+	u.limiter = l
+}
+
+// authenticate returns the user of a request, answering it itself and returning false on failure.
+func (u *Users) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		if name := u.tokenUser(token); name != "" {
+			return name, true
+		}
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		valid, answered := u.passwordCheck(w, r, name, password)
+		if answered {
+			return "", false
+		}
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Basic realm="bangs"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return "", false
+		}
+		return name, true
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if name, ok := u.verifySession(cookie.Value); ok {
+			return name, true
+		}
+	}
+	return "", true
+}
+
+// passwordCheck reports whether password is right for name, answering 429 over the check limit.
+func (u *Users) passwordCheck(w http.ResponseWriter, r *http.Request, name, password string) (ok, answered bool) {
+	key := u.credentialKey(name, password)
+	u.mu.Lock()
+	checked, found := u.verified[key]
+	u.mu.Unlock()
+	if found && time.Since(checked) < verifiedDuration {
+		return true, false
+	}
+	if u.limiter != nil && !u.limiter.Check(w, r) {
+		return false, true
+	}
+	if !u.checkPassword(name, password) {
+		return false, false
+	}
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.verified == nil {
+		u.verified = make(map[string]time.Time)
+	}
+	for k, t := range u.verified {
+		if now.Sub(t) >= verifiedDuration {
+			delete(u.verified, k)
+		}
+	}
+	u.verified[key] = now
+	return true, false
+}
+
+// credentialKey identifies credentials without keeping the password.
+func (u *Users) credentialKey(name, password string) string {
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(name + "\x00" + password))
+	return string(mac.Sum(nil))
+}
+
+func (u *Users) tokenUser(token string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user := ""
+	for t, name := range u.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			user = name
+		}
+	}
+	return user
+}
+
+func (u *Users) checkPassword(name, password string) bool {
+	u.mu.Lock()
+	hash, ok := u.passwords[name]
+	u.mu.Unlock()
+	if !ok {
+		return false
+	}
+	return checkPassword(hash, password)
+}
+
+// session returns a cookie value for name that is valid until expires.
+func (u *Users) session(name string, expires time.Time) string {
+	payload := name + "|" + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession returns the user of a signed, unexpired session cookie value.
+func (u *Users) verifySession(value string) (string, bool) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return "", false
+	}
+	name, expiry, _ := strings.Cut(string(payload), "|")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix || !u.exists(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// Middleware sets the user of each request and layers the overlay of the user or /u/<name>/ over its registry.
+func (u *Users) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := u.authenticate(w, r)
+		if !ok {
+			return
+		}
+		overlay := name
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/u/"); ok {
+			prefixed, path, _ := strings.Cut(rest, "/")
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + path
+			r.URL.RawPath = ""
+			if !u.exists(prefixed) || (!isSearch(r) && name != prefixed) {
+				http.NotFound(w, r)
+				return
+			}
+			overlay = prefixed
+		}
+		ctx := r.Context()
+		if name != "" {
+			ctx = context.WithValue(ctx, userKey{}, name)
+		}
+		if overlay != "" {
+			ctx = context.WithValue(ctx, registryKey{}, u.Registry(overlay, RequestRegistry(r)))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isSearch reports whether r only resolves a query.
+func isSearch(r *http.Request) bool {
+	if r.URL.Query().Get("q") == "" {
+		return false
+	}
+	switch r.URL.Path {
+	case "/", "/bang/", "/explain":
+		return true
+	}
+	return false
+}
+
+// Handler serves POST /login, POST /logout and GET /user.
+func (u *Users) Handler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("POST /login", u.login)
+	router.HandleFunc("POST /logout", u.logout)
+	router.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		name := RequestUser(r)
+		u.mu.Lock()
+		_, overlay := u.overlays[name]
+		u.mu.Unlock()
+		writeJSON(w, http.StatusOK, struct {
+			User    string `json:"user"`
+			Overlay bool   `json:"overlay"`
+		}{name, overlay})
+	})
+	return router
+}
+
+func (u *Users) login(w http.ResponseWriter, r *http.Request) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		name, password = r.PostFormValue("name"), r.PostFormValue("password")
+	}
+	valid, answered := u.passwordCheck(w, r, name, password)
+	if answered {
+		return
+	}
+	if !valid {
+		w.Header().Set("WWW-Authenticate", `Basic realm="bangs"`)
+		http.Error(w, "Wrong user name or password", http.StatusUnauthorized)
+		return
+	}
+	expires := time.Now().Add(sessionDuration)
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    u.session(name, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, http.StatusOK, struct {
+		User string `json:"user"`
+	}{name})
+}
+
+func (u *Users) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReadUserTokens parses "name=token" pairs into a map of user name to token.
+func ReadUserTokens(pairs []string) (map[string]string, error) {
+	tokens := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("user token '%s' must be name=token", pair)
+		}
+		tokens[name] = token
+	}
+	return tokens, nil
+}
+
+// ReadSessionKey reads the session cookie key from path, creating a random one if it is missing.
+func ReadSessionKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	rand.Read(key)
+	return key, os.WriteFile(path, key, 0o600)
+}
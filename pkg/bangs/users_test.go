@@ -0,0 +1,227 @@
+package bangs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikkadev/bangs/pkg/middleware"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUsers_Middleware(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	SetOptions(false, false, ".")
+
+	reg, err := Parse([]byte(`
+default: 'https://duckduckgo.com/?q={}'
+Google:
+  bang: 'g'
+  url: 'https://www.google.com/search?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+
+	dir := t.TempDir()
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords := filepath.Join(dir, "htpasswd")
+	bobHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(passwords, []byte("# accounts\nalice:"+string(hash)+"\nbob:"+string(bobHash)+"\n"), 0o600)
+	overlays := filepath.Join(dir, "overlays")
+	os.Mkdir(overlays, 0o700)
+	os.WriteFile(filepath.Join(overlays, "alice.yaml"), []byte(`
+Google:
+  bang: 'g'
+  url: 'https://www.google.de/search?q={}'
+`), 0o600)
+	os.WriteFile(filepath.Join(overlays, "carol.yaml"), []byte("{"), 0o600)
+
+	users, err := NewUsers(passwords, map[string]string{"dave": "dave-token"}, overlays, []byte("key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := http.NewServeMux()
+	router.Handle("/", Handler(false, false, "."))
+	router.Handle("/api/", http.StripPrefix("/api", users.Handler()))
+	handler := users.Middleware(router)
+
+	search := func(r *http.Request) (int, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code, w.Header().Get("Location")
+	}
+	shared, personal := "https://www.google.com/search?q=a", "https://www.google.de/search?q=a"
+
+	if _, loc := search(httptest.NewRequest("GET", "/?q=!g+a", nil)); loc != shared {
+		t.Errorf("expected the shared registry without a user, got %s", loc)
+	}
+	h, err := OpenHistory(filepath.Join(dir, "history.jsonl"), 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetHistory(h)
+	defer SetHistory(nil)
+	if _, loc := search(httptest.NewRequest("GET", "/u/alice/?q=!g+a", nil)); loc != personal {
+		t.Errorf("expected alice's overlay for /u/alice/, got %s", loc)
+	}
+	if got := h.Entries("alice", "", 0); len(got) != 0 {
+		t.Errorf("expected an anonymous search under /u/alice/ to stay out of alice's history, got %+v", got)
+	}
+	if got := h.Entries("", "", 0); len(got) != 1 {
+		t.Errorf("expected the anonymous search in the shared history, got %+v", got)
+	}
+	if code, _ := search(httptest.NewRequest("GET", "/u/mallory/?q=!g+a", nil)); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown user prefix, got %d", code)
+	}
+	for _, path := range []string{"/u/alice/bang/list", "/u/alice/api/user", "/u/alice/?q=", "/u/mallory/bang/list"} {
+		if code, _ := search(httptest.NewRequest("GET", path, nil)); code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s without a login, got %d", path, code)
+		}
+	}
+	r := httptest.NewRequest("GET", "/u/alice/bang/list", nil)
+	r.Header.Set("Authorization", "Bearer dave-token")
+	if code, _ := search(r); code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's list, got %d", code)
+	}
+	r = httptest.NewRequest("GET", "/u/alice/api/user", nil)
+	r.SetBasicAuth("alice", "hunter2")
+	if code, _ := search(r); code != http.StatusOK {
+		t.Errorf("expected alice to use their own prefix, got %d", code)
+	}
+	r = httptest.NewRequest("GET", "/?q=!g+a", nil)
+	r.SetBasicAuth("alice", "hunter2")
+	if _, loc := search(r); loc != personal {
+		t.Errorf("expected alice's overlay with basic auth, got %s", loc)
+	}
+	r = httptest.NewRequest("GET", "/?q=!g+a", nil)
+	r.SetBasicAuth("alice", "wrong")
+	if code, _ := search(r); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", code)
+	}
+	r = httptest.NewRequest("GET", "/?q=!g+a", nil)
+	r.Header.Set("Authorization", "Bearer dave-token")
+	if _, loc := search(r); loc != shared {
+		t.Errorf("expected the shared registry for a user without overlay, got %s", loc)
+	}
+
+	r = httptest.NewRequest("POST", "/api/login", strings.NewReader("name=bob&password=password"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected bob to log in, got %d %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly session cookie, got %v", cookies)
+	}
+	r = httptest.NewRequest("GET", "/api/user", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), `"user":"bob"`) {
+		t.Errorf("expected the cookie to identify bob, got %s", w.Body)
+	}
+	cookies[0].Value = strings.Replace(cookies[0].Value, ".", "x.", 1)
+	r = httptest.NewRequest("GET", "/api/user", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), `"user":""`) {
+		t.Errorf("expected a tampered cookie to be ignored, got %s", w.Body)
+	}
+
+	r = httptest.NewRequest("POST", "/api/login", strings.NewReader("name=bob&password=nope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong password to be rejected, got %d", w.Code)
+	}
+
+	for _, hash := range []string{"$apr1$abc$def", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="} {
+		os.WriteFile(passwords, []byte("alice:"+hash+"\n"), 0o600)
+		if err := users.LoadPasswords(); err == nil {
+			t.Errorf("expected an error for the unsupported hash %s", hash)
+		}
+	}
+}
+
+func TestUsers_LimitPasswordChecks(t *testing.T) {
+	oldRegistry := registry.Load()
+	defer registry.Store(oldRegistry)
+	SetOptions(false, false, ".")
+	reg, err := Parse([]byte(`
+default: 'https://duckduckgo.com/?q={}'
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Store(reg)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(passwords, []byte("alice:"+string(hash)+"\n"), 0o600)
+	users, err := NewUsers(passwords, nil, "", []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.LimitPasswordChecks(middleware.NewRateLimiter("password", middleware.Rate{Count: 2, Per: time.Minute}, nil))
+	router := http.NewServeMux()
+	router.Handle("/", Handler(false, false, "."))
+	router.Handle("/api/", http.StripPrefix("/api", users.Handler()))
+	handler := users.Middleware(router)
+
+	serve := func(r *http.Request, remote string) int {
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	basic := func(password string) *http.Request {
+		r := httptest.NewRequest("GET", "/?q=red+shoes", nil)
+		r.SetBasicAuth("alice", password)
+		return r
+	}
+	login := func(password string) *http.Request {
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader("name=alice&password="+password))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	if code := serve(basic("hunter2"), "192.0.2.1:1"); code != http.StatusFound {
+		t.Fatalf("expected the right password to search, got %d", code)
+	}
+	if code := serve(basic("wrong"), "192.0.2.1:1"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", code)
+	}
+	if code := serve(basic("wrong"), "192.0.2.1:1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the third password check to be limited, got %d", code)
+	}
+	if code := serve(login("guess"), "192.0.2.1:1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected logins to share the limit, got %d", code)
+	}
+	if code := serve(basic("hunter2"), "192.0.2.1:1"); code != http.StatusFound {
+		t.Errorf("expected verified credentials to skip the limit, got %d", code)
+	}
+	if code := serve(login("wrong"), "192.0.2.2:1"); code != http.StatusUnauthorized {
+		t.Errorf("expected another client to have its own limit, got %d", code)
+	}
+}
@@ -0,0 +1,85 @@
+package bangs
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON Schema describing the registry file format.
+//
+//go:embed schema.json
+var Schema []byte
+
+// ParseFile parses a registry file without making it the active registry.
+func ParseFile(path string, format Format) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = FormatFromPath(path)
+	}
+	return Parse(data, format)
+}
+
+// Validate returns the problems of a parsed registry that would fail at request time, sorted.
+func (r *Registry) Validate() []error {
+	var problems []error
+
+	for name, entry := range r.Entries.Entries {
+		if strings.ContainsAny(entry.Bang, " \t+") {
+			problems = append(problems, fmt.Errorf("bang '%s' of entry '%s' contains whitespace or '+'", entry.Bang, name))
+		}
+		for _, alias := range entry.Aliases {
+			if strings.ContainsAny(alias, " \t+") {
+				problems = append(problems, fmt.Errorf("alias '%s' of entry '%s' contains whitespace or '+'", alias, name))
+			}
+		}
+		if _, err := entry.URL.Augment("test"); err != nil {
+			problems = append(problems, fmt.Errorf("url of entry '%s' is invalid: %v", name, err))
+		}
+		if entry.Replacement != "" {
+			if _, ok := r.Entries.byBang[entry.Replacement]; !ok {
+				problems = append(problems, fmt.Errorf("replacement of entry '%s' references unknown bang '%s'", name, entry.Replacement))
+			}
+		}
+	}
+
+	for alias, target := range r.Aliases {
+		if _, ok := r.Entries.byBang[alias]; ok {
+			problems = append(problems, fmt.Errorf("alias '%s' shadows the bang of the same name", alias))
+		}
+		for _, ref := range splitRefs(target) {
+			if _, ok := r.Entries.byBang[ref]; !ok {
+				problems = append(problems, fmt.Errorf("alias '%s' references unknown bang '%s'", alias, ref))
+			}
+		}
+	}
+
+	defaultStr := strings.TrimSpace(string(r.Default))
+	switch {
+	case defaultStr == "":
+		problems = append(problems, fmt.Errorf("default is not set"))
+	case strings.Contains(defaultStr, "://"):
+		if _, err := r.Default.Augment("test"); err != nil {
+			problems = append(problems, fmt.Errorf("default url is invalid: %v", err))
+		}
+	default:
+		for _, ref := range splitRefs(defaultStr) {
+			if _, ok := r.Aliases[ref]; ok {
+				continue
+			}
+			if _, ok := r.Entries.byBang[ref]; !ok {
+				problems = append(problems, fmt.Errorf("default references unknown bang or alias '%s'", ref))
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Error() < problems[j].Error()
+	})
+	return problems
+}
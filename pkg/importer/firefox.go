@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+var mozLz4Magic = []byte("mozLz40\x00")
+
+type firefoxSearch struct {
+	Engines []firefoxEngine `json:"engines"`
+}
+
+type firefoxEngine struct {
+	Name           string   `json:"_name"`
+	Description    string   `json:"description"`
+	DefinedAliases []string `json:"_definedAliases"`
+	MetaData       struct {
+		Alias string `json:"alias"`
+	} `json:"_metaData"`
+	URLs []struct {
+		Type     string `json:"type"`
+		Method   string `json:"method"`
+		Template string `json:"template"`
+		Params   []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"params"`
+	} `json:"_urls"`
+}
+
+// ParseFirefox returns the search engines with a keyword from Firefox's search.json.mozlz4.
+func ParseFirefox(r io.Reader) ([]Bang, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeMozLz4(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var search firefoxSearch
+	err = json.Unmarshal(data, &search)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Bang
+	for _, engine := range search.Engines {
+		bang := strings.TrimSpace(engine.MetaData.Alias)
+		if bang == "" && len(engine.DefinedAliases) > 0 {
+			bang = strings.TrimPrefix(strings.TrimSpace(engine.DefinedAliases[0]), "@")
+		}
+		if bang == "" {
+			continue
+		}
+
+		for _, u := range engine.URLs {
+			if u.Type != "" && u.Type != "text/html" {
+				continue
+			}
+			if u.Method != "" && !strings.EqualFold(u.Method, "get") {
+				continue
+			}
+			params := make([]queryParam, len(u.Params))
+			for i, p := range u.Params {
+				params[i] = queryParam{p.Name, p.Value}
+			}
+			tmpl, err := convertTemplate(u.Template, params)
+			if err != nil {
+				return nil, fmt.Errorf("firefox engine '%s': %w", engine.Name, err)
+			}
+			result = append(result, Bang{
+				Name: engine.Name,
+				Entry: bangs.Entry{
+					Bang:        bang,
+					URL:         bangs.QueryURL(tmpl),
+					Description: engine.Description,
+				},
+			})
+			break
+		}
+	}
+	return result, nil
+}
+
+// decodeMozLz4 unpacks Mozilla's lz4 container: magic, decompressed size and one lz4 block.
+func decodeMozLz4(data []byte) ([]byte, error) {
+	if len(data) < 12 || !bytes.Equal(data[:8], mozLz4Magic) {
+		return nil, fmt.Errorf("not a mozlz4 file")
+	}
+	size := binary.LittleEndian.Uint32(data[8:12])
+	return decodeLz4Block(data[12:], int(size))
+}
+
+// maxLz4Ratio bounds how much larger than its input an lz4 block can decompress to.
+const maxLz4Ratio = 256
+
+func decodeLz4Block(src []byte, size int) ([]byte, error) {
+	if size > maxLz4Ratio*len(src)+16 {
+		return nil, fmt.Errorf("lz4 size %d is too large for %d bytes of input", size, len(src))
+	}
+	dst := make([]byte, 0, size)
+	errCorrupt := fmt.Errorf("corrupt lz4 block")
+
+	readLen := func(i int, n int) (int, int, error) {
+		if n != 15 {
+			return n, i, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, 0, errCorrupt
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return n, i, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		litLen, next, err := readLen(i, int(token>>4))
+		if err != nil {
+			return nil, err
+		}
+		i = next
+		if i+litLen > len(src) {
+			return nil, errCorrupt
+		}
+		if len(dst)+litLen > size {
+			return nil, errCorrupt
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+
+		// The last sequence only carries literals.
+		if i >= len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errCorrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errCorrupt
+		}
+
+		matchLen, next, err := readLen(i, int(token&0x0f))
+		if err != nil {
+			return nil, err
+		}
+		i = next
+		matchLen += 4
+		if len(dst)+matchLen > size {
+			return nil, errCorrupt
+		}
+
+		start := len(dst) - offset
+		for k := 0; k < matchLen; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+
+	if len(dst) != size {
+		return nil, fmt.Errorf("lz4 size mismatch: expected %d, got %d", size, len(dst))
+	}
+	return dst, nil
+}
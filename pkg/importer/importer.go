@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+// Bang is an imported search shortcut and the name it is stored under.
+type Bang struct {
+	Name  string
+	Entry bangs.Entry
+}
+
+type Format string
+
+const (
+	FormatNetscape   Format = "netscape"
+	FormatFirefox    Format = "firefox"
+	FormatOpenSearch Format = "opensearch"
+)
+
+// DetectFormat guesses the import format from a file name or URL.
+func DetectFormat(source string) (Format, error) {
+	lower := strings.ToLower(source)
+	switch {
+	case strings.HasSuffix(lower, ".mozlz4"):
+		return FormatFirefox, nil
+	case strings.HasSuffix(lower, ".html"), strings.HasSuffix(lower, ".htm"):
+		return FormatNetscape, nil
+	case strings.HasSuffix(lower, ".xml"), strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"):
+		return FormatOpenSearch, nil
+	}
+	return "", fmt.Errorf("cannot detect import format of '%s'", source)
+}
+
+// client fetches OpenSearch documents, timing out rather than hanging an import.
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Read imports all bangs from a file or, for OpenSearch, an http(s) URL.
+func Read(source string, format Format, bang string) ([]Bang, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		res, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("fetching '%s': unexpected status %s", source, res.Status)
+		}
+		r = res.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	switch format {
+	case FormatNetscape:
+		return ParseNetscape(r)
+	case FormatFirefox:
+		return ParseFirefox(r)
+	case FormatOpenSearch:
+		b, err := ParseOpenSearch(r, bang)
+		if err != nil {
+			return nil, err
+		}
+		return []Bang{b}, nil
+	}
+	return nil, fmt.Errorf("unknown import format '%s'", format)
+}
+
+var nonBangChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// bangFromName derives a bang from a human readable name, e.g. "Stack Overflow" -> "stackoverflow".
+func bangFromName(name string) string {
+	return nonBangChars.ReplaceAllString(strings.ToLower(name), "")
+}
+
+// checkEntry makes sure an imported entry can actually be used for forwarding.
+func checkEntry(e bangs.Entry) error {
+	if strings.TrimSpace(e.Bang) == "" {
+		return fmt.Errorf("empty bang")
+	}
+	if strings.ContainsAny(e.Bang, " +") {
+		return fmt.Errorf("bang '%s' contains whitespace or '+'", e.Bang)
+	}
+	if _, err := e.URL.Augment("test"); err != nil {
+		return fmt.Errorf("url '%s': %w", e.URL, err)
+	}
+	return nil
+}
+
+// Skipped describes an imported bang that was not merged and why.
+type Skipped struct {
+	Bang   Bang
+	Reason string
+}
+
+// Merge appends bangs whose name and bang are free to the YAML registry file at path.
+func Merge(path string, imported []Bang) (added []Bang, skipped []Skipped, err error) {
+	doc, err := bangs.OpenDocument(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	names, usedBangs := doc.Taken()
+
+	for _, b := range imported {
+		if err := checkEntry(b.Entry); err != nil {
+			skipped = append(skipped, Skipped{b, err.Error()})
+			continue
+		}
+		if names[b.Name] {
+			skipped = append(skipped, Skipped{b, fmt.Sprintf("name '%s' already exists", b.Name)})
+			continue
+		}
+		if usedBangs[b.Entry.Bang] {
+			skipped = append(skipped, Skipped{b, fmt.Sprintf("bang '%s' already exists", b.Entry.Bang)})
+			continue
+		}
+		if err := doc.AddEntry(b.Name, b.Entry); err != nil {
+			skipped = append(skipped, Skipped{b, err.Error()})
+			continue
+		}
+		names[b.Name] = true
+		usedBangs[b.Entry.Bang] = true
+		added = append(added, b)
+	}
+
+	if len(added) == 0 {
+		return added, skipped, nil
+	}
+	return added, skipped, doc.Save()
+}
@@ -0,0 +1,241 @@
+package importer
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+const netscapeExport = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks Menu</H1>
+<DL><p>
+    <DT><H3>Development</H3>
+    <DL><p>
+        <DT><A HREF="https://pkg.go.dev/search?q=%s" SHORTCUTURL="godoc">Go Packages</A>
+        <DT><A HREF="https://go.dev/">Go Homepage</A>
+    </DL><p>
+    <DT><A HREF="https://en.wikipedia.org/wiki/Special:Search?search=%s" SHORTCUTURL="w">Wikipedia</A>
+</DL>
+`
+
+func TestParseNetscape(t *testing.T) {
+	got, err := ParseNetscape(strings.NewReader(netscapeExport))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Bang{
+		{Name: "Go Packages", Entry: bangs.Entry{Bang: "godoc", URL: "https://pkg.go.dev/search?q={}", Description: "Go Packages", Category: "Development"}},
+		{Name: "Wikipedia", Entry: bangs.Entry{Bang: "w", URL: "https://en.wikipedia.org/wiki/Special:Search?search={}", Description: "Wikipedia"}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d bangs, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || !got[i].Entry.Equals(want[i].Entry) {
+			t.Errorf("bang %d: expected %v %v, got %v %v", i, want[i].Name, want[i].Entry, got[i].Name, got[i].Entry)
+		}
+	}
+}
+
+func TestParseOpenSearch(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>Stack Overflow</ShortName>
+  <Description>Search Stack Overflow</Description>
+  <Url type="application/x-suggestions+json" template="https://stackoverflow.com/suggest?q={searchTerms}"/>
+  <Url type="text/html" method="get" template="https://stackoverflow.com/search?q={searchTerms}&amp;page={startPage?}"/>
+</OpenSearchDescription>`
+
+	got, err := ParseOpenSearch(strings.NewReader(doc), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := bangs.Entry{Bang: "stackoverflow", URL: "https://stackoverflow.com/search?q={}&page=", Description: "Search Stack Overflow"}
+	if got.Name != "Stack Overflow" || !got.Entry.Equals(want) {
+		t.Errorf("expected %v, got %v %v", want, got.Name, got.Entry)
+	}
+
+	_, err = ParseOpenSearch(strings.NewReader(`<OpenSearchDescription><ShortName>x</ShortName><Url type="text/html" template="https://x/?q={searchTerms}&amp;c={count}"/></OpenSearchDescription>`), "x")
+	if err == nil {
+		t.Errorf("expected error for unsupported template parameter")
+	}
+}
+
+// literalMozLz4 builds a valid mozlz4 container holding data as a single
+// literal-only lz4 sequence.
+func literalMozLz4(data []byte) []byte {
+	out := append([]byte{}, mozLz4Magic...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, 0xF0)
+	n := len(data) - 15
+	for ; n >= 255; n -= 255 {
+		out = append(out, 255)
+	}
+	out = append(out, byte(n))
+	return append(out, data...)
+}
+
+func TestParseFirefox(t *testing.T) {
+	search := `{"version":6,"engines":[
+		{"_name":"DuckDuckGo","_metaData":{"alias":"d"},"_urls":[
+			{"type":"application/x-suggestions+json","template":"https://ac.duckduckgo.com/ac/","params":[{"name":"q","value":"{searchTerms}"}]},
+			{"template":"https://duckduckgo.com/","params":[{"name":"q","value":"{searchTerms}"}]}]},
+		{"_name":"No Keyword","_urls":[{"template":"https://example.com/?q={searchTerms}"}]},
+		{"_name":"MDN","_definedAliases":["@mdn"],"_urls":[{"template":"https://developer.mozilla.org/search?q={searchTerms}"}]}
+	]}`
+
+	got, err := ParseFirefox(strings.NewReader(string(literalMozLz4([]byte(search)))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 bangs, got %d: %v", len(got), got)
+	}
+	if got[0].Entry.Bang != "d" || got[0].Entry.URL != "https://duckduckgo.com/?q={}" {
+		t.Errorf("unexpected first bang: %v", got[0].Entry)
+	}
+	if got[1].Entry.Bang != "mdn" || got[1].Entry.URL != "https://developer.mozilla.org/search?q={}" {
+		t.Errorf("unexpected second bang: %v", got[1].Entry)
+	}
+
+	_, err = ParseFirefox(strings.NewReader(search))
+	if err == nil {
+		t.Errorf("expected error for missing mozlz4 header")
+	}
+}
+
+func TestDecodeLz4Block_Match(t *testing.T) {
+	// "abcabcabcabc": 3 literals followed by a match of length 9 at offset 3.
+	block := []byte{0x35, 'a', 'b', 'c', 0x03, 0x00}
+	got, err := decodeLz4Block(block, 12)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "abcabcabcabc" {
+		t.Errorf("expected abcabcabcabc, got %q", got)
+	}
+}
+
+func TestDecodeLz4Block_Size(t *testing.T) {
+	block := []byte{0x35, 'a', 'b', 'c', 0x03, 0x00}
+	if _, err := decodeLz4Block(block, 1<<31-1); err == nil {
+		t.Errorf("expected an error for a size the input cannot hold")
+	}
+	if _, err := decodeLz4Block(block, 6); err == nil {
+		t.Errorf("expected an error for output beyond the stated size")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bangs.yaml")
+	existing := `# My bangs
+default: 'g'
+
+Google:
+  bang: 'g' # the usual
+  url: 'https://www.google.com/search?q={}'
+`
+	err := os.WriteFile(path, []byte(existing), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, skipped, err := Merge(path, []Bang{
+		{Name: "Go Packages", Entry: bangs.Entry{Bang: "godoc", URL: "https://pkg.go.dev/search?q={}", Category: "Development"}},
+		{Name: "Other Google", Entry: bangs.Entry{Bang: "g", URL: "https://google.de/search?q={}"}},
+		{Name: "Google", Entry: bangs.Entry{Bang: "gg", URL: "https://google.de/search?q={}"}},
+		{Name: "Broken", Entry: bangs.Entry{Bang: "br", URL: "https://example.com/"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 1 || len(skipped) != 3 {
+		t.Fatalf("expected 1 added and 3 skipped, got %v and %v", added, skipped)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, want := range []string{"# My bangs", "default: 'g'\n\nGoogle:", "# the usual", "Go Packages:", "bang: 'godoc'", "category: 'Development'"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected merged file to contain %q, got:\n%s", want, content)
+		}
+	}
+
+	err = bangs.Load(path)
+	if err != nil {
+		t.Fatalf("merged file does not load: %v", err)
+	}
+}
+
+func TestMerge_Version2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bangs.yaml")
+	existing := `version: 2
+default: 'g'
+bangs:
+  Google:
+    bang: 'g'
+    url: 'https://www.google.com/search?q={}'
+`
+	err := os.WriteFile(path, []byte(existing), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, _, err := Merge(path, []Bang{
+		{Name: "Go Packages", Entry: bangs.Entry{Bang: "godoc", URL: "https://pkg.go.dev/search?q={}"}},
+		{Name: "Google", Entry: bangs.Entry{Bang: "gg", URL: "https://google.de/search?q={}"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(added) != 1 {
+		t.Fatalf("expected 1 added, got %v", added)
+	}
+
+	reg, err := bangs.ParseFile(path, bangs.FormatYAML)
+	if err != nil {
+		t.Fatalf("merged file does not parse: %v", err)
+	}
+	if _, ok := reg.Entries.Entries["Go Packages"]; !ok {
+		t.Errorf("expected new entry under bangs, got %v", reg.Entries.Entries)
+	}
+}
+
+func TestMerge_Targets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bangs.yaml")
+	os.WriteFile(path, []byte("Google:\n  bang: 'g'\n  url: 'https://www.google.com/search?q={}'\n  aliases: ['goog']\n"), 0o644)
+	added, skipped, err := Merge(path, []Bang{{Name: "Goog", Entry: bangs.Entry{Bang: "goog", URL: "https://goog.example.com/?q={}"}}})
+	if err != nil || len(added) != 0 || len(skipped) != 1 || skipped[0].Reason != "bang 'goog' already exists" {
+		t.Errorf("expected a clash with an entry alias to be skipped, got %v, %v, %v", added, skipped, err)
+	}
+
+	created := filepath.Join(dir, "new.yaml")
+	added, _, err = Merge(created, []Bang{{Name: "Go Packages", Entry: bangs.Entry{Bang: "godoc", URL: "https://pkg.go.dev/search?q={}"}}})
+	if err != nil || len(added) != 1 {
+		t.Fatalf("expected the file to be created, got %v, %v", added, err)
+	}
+	if _, err := bangs.ParseFile(created, bangs.FormatYAML); err != nil {
+		t.Errorf("created file does not parse: %v", err)
+	}
+
+	for _, name := range []string{"bangs.json", "bangs.toml"} {
+		target := filepath.Join(dir, name)
+		if _, _, err := Merge(target, []Bang{{Name: "Go Packages", Entry: bangs.Entry{Bang: "godoc", URL: "https://pkg.go.dev/search?q={}"}}}); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+		if _, err := os.Stat(target); err == nil {
+			t.Errorf("expected %s not to be written", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"io"
+	"strings"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+
+	"golang.org/x/net/html"
+)
+
+// ParseNetscape returns the bookmarks with a keyword and a '%s' placeholder, using their folder as category.
+func ParseNetscape(r io.Reader) ([]Bang, error) {
+	var (
+		result  []Bang
+		folders []string
+		heading string
+		inTitle bool
+		current *Bang
+	)
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return result, nil
+			}
+			return nil, z.Err()
+
+		case html.StartTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "h3":
+				inTitle = true
+				heading = ""
+			case "dl":
+				folders = append(folders, heading)
+				heading = ""
+			case "a":
+				var href, keyword string
+				for _, attr := range tok.Attr {
+					switch attr.Key {
+					case "href":
+						href = attr.Val
+					case "shortcuturl":
+						keyword = strings.TrimSpace(attr.Val)
+					}
+				}
+				if keyword == "" || !strings.Contains(href, "%s") {
+					continue
+				}
+				category := ""
+				if len(folders) > 0 {
+					category = folders[len(folders)-1]
+				}
+				current = &Bang{
+					Entry: bangs.Entry{
+						Bang:     keyword,
+						URL:      bangs.QueryURL(strings.ReplaceAll(href, "%s", "{}")),
+						Category: category,
+					},
+				}
+			}
+
+		case html.EndTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "h3":
+				inTitle = false
+			case "dl":
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			case "a":
+				if current == nil {
+					continue
+				}
+				current.Name = strings.TrimSpace(current.Name)
+				if current.Name == "" {
+					current.Name = current.Entry.Bang
+				}
+				current.Entry.Description = current.Name
+				result = append(result, *current)
+				current = nil
+			}
+
+		case html.TextToken:
+			text := string(z.Text())
+			if inTitle {
+				heading += strings.TrimSpace(text)
+			} else if current != nil {
+				current.Name += text
+			}
+		}
+	}
+}
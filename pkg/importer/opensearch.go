@@ -0,0 +1,117 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/dikkadev/bangs/pkg/bangs"
+)
+
+type openSearchDescription struct {
+	ShortName   string          `xml:"ShortName"`
+	Description string          `xml:"Description"`
+	Tags        string          `xml:"Tags"`
+	URLs        []openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string            `xml:"type,attr"`
+	Method   string            `xml:"method,attr"`
+	Template string            `xml:"template,attr"`
+	Params   []openSearchParam `xml:"Param"`
+}
+
+type openSearchParam struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ParseOpenSearch converts the HTML search URL of an OpenSearch document into a bang.
+func ParseOpenSearch(r io.Reader, bang string) (Bang, error) {
+	var desc openSearchDescription
+	err := xml.NewDecoder(r).Decode(&desc)
+	if err != nil {
+		return Bang{}, err
+	}
+
+	name := strings.TrimSpace(desc.ShortName)
+	if name == "" {
+		return Bang{}, fmt.Errorf("opensearch description has no ShortName")
+	}
+	if bang == "" {
+		bang = bangFromName(name)
+	}
+
+	for _, u := range desc.URLs {
+		if u.Type != "" && u.Type != "text/html" {
+			continue
+		}
+		if u.Method != "" && !strings.EqualFold(u.Method, "get") {
+			continue
+		}
+		params := make([]queryParam, len(u.Params))
+		for i, p := range u.Params {
+			params[i] = queryParam{p.Name, p.Value}
+		}
+		tmpl, err := convertTemplate(u.Template, params)
+		if err != nil {
+			return Bang{}, fmt.Errorf("opensearch '%s': %w", name, err)
+		}
+		return Bang{
+			Name: name,
+			Entry: bangs.Entry{
+				Bang:        bang,
+				URL:         bangs.QueryURL(tmpl),
+				Description: strings.TrimSpace(desc.Description),
+			},
+		}, nil
+	}
+
+	return Bang{}, fmt.Errorf("opensearch '%s' has no text/html GET url", name)
+}
+
+type queryParam struct {
+	Name  string
+	Value string
+}
+
+var templateParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// convertTemplate turns an OpenSearch URL template into a bangs URL with a '{}' placeholder.
+func convertTemplate(template string, params []queryParam) (string, error) {
+	full := template
+	for _, p := range params {
+		sep := "&"
+		if !strings.Contains(full, "?") {
+			sep = "?"
+		}
+		full += sep + p.Name + "=" + p.Value
+	}
+
+	var unknown []string
+	converted := templateParam.ReplaceAllStringFunc(full, func(m string) string {
+		name := m[1 : len(m)-1]
+		switch {
+		case name == "searchTerms":
+			return "{}"
+		case strings.HasSuffix(name, "?"):
+			return ""
+		case name == "inputEncoding", name == "outputEncoding":
+			return "UTF-8"
+		case name == "language":
+			return "*"
+		}
+		unknown = append(unknown, name)
+		return m
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unsupported template parameters %v", unknown)
+	}
+	if !strings.Contains(converted, "{}") {
+		return "", fmt.Errorf("template '%s' has no {searchTerms}", template)
+	}
+	return converted, nil
+}
@@ -16,11 +16,15 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Logger logs every request with its status and duration, redacted as the log mode allows.
 func Logger(logger *slog.Logger, msg string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		if logMode == LogOff {
+			return next
+		}
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			queries := r.URL.Query()
+			queries := redactValues(r.URL.Query())
 			writer := &responseWriterWrapper{w, http.StatusOK}
 			next.ServeHTTP(writer, r)
 			timeTaken := time.Since(start)
@@ -33,8 +37,12 @@ func Logger(logger *slog.Logger, msg string) func(http.Handler) http.Handler {
 				"duration", timeTaken,
 			}
 
+			if id := RequestID(r); id != "" {
+				logArgs = append(logArgs, "requestId", id)
+			}
+
 			if writer.StatusCode == http.StatusFound {
-				logArgs = append(logArgs, "location", w.Header().Get("Location"))
+				logArgs = append(logArgs, "location", RedactURL(w.Header().Get("Location")))
 			}
 
 			logger.Info(msg, logArgs...)
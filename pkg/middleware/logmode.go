@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dikkadev/prettyslog"
+)
+
+// LogMode decides how much of what people search for ends up in the logs.
+type LogMode string
+
+const (
+	// LogFull logs queries and redirect targets as they are.
+	LogFull LogMode = "full"
+	// LogRedacted keeps the bang of a query, replaces the rest with its length and a hash, and cuts URLs to their host.
+	LogRedacted LogMode = "redacted"
+	// LogOff writes no request logs and hides queries in all other logs.
+	LogOff LogMode = "off"
+)
+
+// LogFormat is how log lines are written.
+type LogFormat string
+
+const (
+	// LogText writes colored lines for people.
+	LogText LogFormat = "text"
+	// LogJSON writes one JSON object per line for log pipelines.
+	LogJSON LogFormat = "json"
+)
+
+var (
+	logMode   = LogFull
+	logFormat = LogText
+	// logHashKey keys the query hashes of redacted logs, new on every start.
+	logHashKey = rand.Text()
+)
+
+// ParseLogMode reads a log mode; "" is LogFull.
+func ParseLogMode(s string) (LogMode, error) {
+	switch mode := LogMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return LogFull, nil
+	case LogFull, LogRedacted, LogOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown log mode '%s', expected full, redacted or off", s)
+}
+
+// ParseLogFormat reads a log format; "" is LogText.
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch format := LogFormat(strings.ToLower(strings.TrimSpace(s))); format {
+	case "":
+		return LogText, nil
+	case LogText, LogJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format '%s', expected text or json", s)
+}
+
+// SetLogging sets the log mode and format. Call it before creating loggers.
+func SetLogging(mode LogMode, format LogFormat) {
+	logMode = mode
+	logFormat = format
+}
+
+// LogHandler returns the handler for the logs of a component.
+func LogHandler(component string, level slog.Level) slog.Handler {
+	if logFormat == LogJSON {
+		handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+		return handler.WithAttrs([]slog.Attr{slog.String("component", component)})
+	}
+	return prettyslog.NewPrettyslogHandler(component, prettyslog.WithLevel(level))
+}
+
+// NewLogger returns a logger for a component at the level of the default logger.
+func NewLogger(component string) *slog.Logger {
+	level := slog.LevelInfo
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		level = slog.LevelDebug
+	}
+	return slog.New(LogHandler(component, level))
+}
+
+// RedactQuery returns q as the log mode allows, e.g. "!g [9 chars 1a2b3c4d]" when redacted.
+func RedactQuery(q string) string {
+	switch logMode {
+	case LogFull:
+		return q
+	case LogOff:
+		return "[hidden]"
+	}
+	bang, rest := "", q
+	switch {
+	case strings.HasPrefix(q, "##"):
+		bang, rest = "##", q[2:]
+	case strings.HasPrefix(q, "!"):
+		bang, rest, _ = strings.Cut(q, " ")
+	}
+	mac := hmac.New(sha256.New, []byte(logHashKey))
+	mac.Write([]byte(rest))
+	redacted := fmt.Sprintf("[%d chars %s]", len(rest), hex.EncodeToString(mac.Sum(nil))[:8])
+	if bang == "" {
+		return redacted
+	}
+	return bang + " " + redacted
+}
+
+// RedactURL returns u as the log mode allows, only scheme and host unless LogFull.
+func RedactURL(u string) string {
+	if logMode == LogFull {
+		return u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "[hidden]"
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/[hidden]"
+}
+
+// redactValues returns query parameters as the log mode allows.
+func redactValues(values url.Values) url.Values {
+	if logMode == LogFull {
+		return values
+	}
+	redacted := make(url.Values, len(values))
+	for key, list := range values {
+		for _, v := range list {
+			redacted.Add(key, RedactQuery(v))
+		}
+	}
+	return redacted
+}
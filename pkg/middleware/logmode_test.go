@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactQuery(t *testing.T) {
+	defer SetLogging(LogFull, LogText)
+
+	SetLogging(LogFull, LogText)
+	if got := RedactQuery("!g red shoes"); got != "!g red shoes" {
+		t.Errorf("expected the full query, got %s", got)
+	}
+	if got := RedactURL("https://example.com/?q=red"); got != "https://example.com/?q=red" {
+		t.Errorf("expected the full URL, got %s", got)
+	}
+
+	SetLogging(LogRedacted, LogText)
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"!g red shoes", `^!g \[9 chars [0-9a-f]{8}\]$`},
+		{"##red shoes", `^## \[9 chars [0-9a-f]{8}\]$`},
+		{"red shoes", `^\[9 chars [0-9a-f]{8}\]$`},
+		{"!g", `^!g \[0 chars [0-9a-f]{8}\]$`},
+	}
+	for _, tt := range tests {
+		if got := RedactQuery(tt.input); !regexp.MustCompile(tt.want).MatchString(got) {
+			t.Errorf("RedactQuery(%q) = %q, expected to match %s", tt.input, got, tt.want)
+		}
+	}
+	if RedactQuery("!g a") != RedactQuery("!g a") || RedactQuery("!g a") == RedactQuery("!g b") {
+		t.Errorf("expected equal queries to hash equally and different ones differently")
+	}
+	if got := RedactURL("https://example.com/search?q=red"); got != "https://example.com/[hidden]" {
+		t.Errorf("expected only the host, got %s", got)
+	}
+
+	SetLogging(LogOff, LogText)
+	if got := RedactQuery("!g red shoes"); got != "[hidden]" {
+		t.Errorf("expected the query to be hidden, got %s", got)
+	}
+}
+
+func TestLogger_Modes(t *testing.T) {
+	defer SetLogging(LogFull, LogText)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/search?q=secret+term", http.StatusFound)
+	})
+	serve := func(mode LogMode) string {
+		SetLogging(mode, LogJSON)
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		Logger(logger, "test")(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q=!g+secret+term", nil))
+		return buf.String()
+	}
+
+	if got := serve(LogFull); !strings.Contains(got, "secret term") {
+		t.Errorf("expected the full query in full mode, got %s", got)
+	}
+	got := serve(LogRedacted)
+	if strings.Contains(got, "secret") {
+		t.Errorf("expected no search terms in redacted mode, got %s", got)
+	}
+	if !strings.Contains(got, "!g [11 chars") || !strings.Contains(got, `"location":"https://example.com/[hidden]"`) {
+		t.Errorf("expected the bang, query length and host in redacted mode, got %s", got)
+	}
+	if got := serve(LogOff); got != "" {
+		t.Errorf("expected no request log in off mode, got %s", got)
+	}
+}
+
+func TestParseLogMode(t *testing.T) {
+	if mode, err := ParseLogMode(" Redacted "); err != nil || mode != LogRedacted {
+		t.Errorf("expected redacted, got %s, %v", mode, err)
+	}
+	if mode, err := ParseLogMode(""); err != nil || mode != LogFull {
+		t.Errorf("expected full by default, got %s, %v", mode, err)
+	}
+	if _, err := ParseLogMode("quiet"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
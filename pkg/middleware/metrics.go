@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type outcomeKey struct{}
+
+// outcome holds the label values a handler reports for its request.
+type outcome struct {
+	labelValues []string
+}
+
+// SetOutcome labels the request for RequestMetrics, e.g. with how a search was resolved.
+func SetOutcome(r *http.Request, labelValues ...string) {
+	if o, ok := r.Context().Value(outcomeKey{}).(*outcome); ok {
+		o.labelValues = labelValues
+	}
+}
+
+// RequestMetrics counts and times the requests a handler labels with SetOutcome.
+func RequestMetrics(requests, latency *Metric) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			o := &outcome{}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), outcomeKey{}, o)))
+			if o.labelValues == nil {
+				return
+			}
+			requests.Inc(o.labelValues...)
+			latency.Observe(time.Since(start).Seconds(), o.labelValues...)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAssignRequestID(t *testing.T) {
+	var seen string
+	handler := AssignRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"generated", "", false},
+		{"taken", "abc-123_x.y:z", true},
+		{"invalid characters", "abc\"<script>", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if seen == "" || w.Header().Get("X-Request-ID") != seen {
+				t.Errorf("expected the ID %q in the context and response header, got %q", seen, w.Header().Get("X-Request-ID"))
+			}
+			if (seen == tt.header) != tt.keep {
+				t.Errorf("expected keep=%v for %q, got %q", tt.keep, tt.header, seen)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := AssignRequestID(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "https://example.com")
+		panic("boom")
+	})))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "req-1") || w.Header().Get("Location") != "" {
+		t.Errorf("expected an error page with the request ID and no redirect, got %v %s", w.Header(), w.Body)
+	}
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected the connection to be aborted after a started response, got %v", v)
+		}
+	}()
+	Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var nonce string
+	handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if nonce == "" || !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("expected the nonce %q in the policy, got %q", nonce, w.Header().Get("Content-Security-Policy"))
+	}
+	first := nonce
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if nonce == first {
+		t.Errorf("expected a new nonce per request")
+	}
+	var imgSrc []string
+	for directive := range strings.SplitSeq(w.Header().Get("Content-Security-Policy"), ";") {
+		if fields := strings.Fields(directive); len(fields) > 0 && fields[0] == "img-src" {
+			imgSrc = fields[1:]
+		}
+	}
+	if !slices.Contains(imgSrc, "https:") {
+		t.Errorf("expected img-src to allow the list's favicons from https://host/favicon.ico, got %v", imgSrc)
+	}
+	for header, want := range map[string]string{"X-Frame-Options": "DENY", "Referrer-Policy": "no-referrer", "X-Content-Type-Options": "nosniff"} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("expected %s: %s, got %q", header, want, got)
+		}
+	}
+}
+
+func TestLimitQuery(t *testing.T) {
+	handler := LimitQuery(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		q    string
+		want int
+	}{
+		{"!g shoes", http.StatusOK},
+		{"!g red shoes", http.StatusBadRequest},
+		{"!g a\nb", http.StatusBadRequest},
+		{"!g a\x00", http.StatusBadRequest},
+		{"!g a\u0085", http.StatusBadRequest},
+		{"!g füße", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/?q="+url.QueryEscape(tt.q), nil))
+		if w.Code != tt.want {
+			t.Errorf("q=%q: expected %d, got %d", tt.q, tt.want, w.Code)
+		}
+	}
+}
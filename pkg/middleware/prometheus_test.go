@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("test_requests_total", "Requests by outcome.", "outcome")
+	latency := reg.Histogram("test_duration_seconds", "Latency.", []float64{0.1, 1}, "outcome")
+	up := reg.Gauge("test_up", "Whether it works.")
+
+	requests.Inc("ok")
+	requests.Add(2, `say "hi"`+"\n")
+	latency.Observe(0.05, "ok")
+	latency.Observe(0.5, "ok")
+	latency.Observe(5, "ok")
+	up.Set(1)
+
+	var sb strings.Builder
+	if err := reg.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Requests by outcome.
+# TYPE test_requests_total counter
+test_requests_total{outcome="ok"} 1
+test_requests_total{outcome="say \"hi\"\n"} 2
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{outcome="ok",le="0.1"} 1
+test_duration_seconds_bucket{outcome="ok",le="1"} 2
+test_duration_seconds_bucket{outcome="ok",le="+Inf"} 3
+test_duration_seconds_sum{outcome="ok"} 5.55
+test_duration_seconds_count{outcome="ok"} 3
+# HELP test_up Whether it works.
+# TYPE test_up gauge
+test_up 1
+`
+	if sb.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, sb.String())
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("test_requests_total", "Requests.", "outcome")
+	latency := reg.Histogram("test_duration_seconds", "Latency.", DefaultBuckets, "outcome")
+	handler := RequestMetrics(requests, latency)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			SetOutcome(r, "found")
+		}
+	}))
+
+	for _, path := range []string{"/search", "/search", "/list"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{`test_requests_total{outcome="found"} 2`, `test_duration_seconds_count{outcome="found"} 2`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "test_requests_total{") != 1 {
+		t.Errorf("expected requests without outcome not to be counted, got\n%s", body)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// LimitQuery answers 400 to a q parameter over maxLength bytes (0 for any) or with control characters.
+func LimitQuery(maxLength int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, q := range r.URL.Query()["q"] {
+				if maxLength > 0 && len(q) > maxLength {
+					http.Error(w, fmt.Sprintf("Query is too long, the limit is %d bytes", maxLength), http.StatusBadRequest)
+					return
+				}
+				if strings.ContainsFunc(q, unicode.IsControl) {
+					http.Error(w, "Query contains control characters", http.StatusBadRequest)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
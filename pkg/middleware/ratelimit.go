@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateLimitedRequests = DefaultRegistry.Counter("http_requests_rate_limited_total",
+	"Requests rejected with 429 by a rate limit, by limit.", "limit")
+
+// Rate is a number of requests per period, which is also the burst allowed.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate reads a rate like "60/m", "5/s" or "1000/h"; "" or "0" means no limit.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+	count, unit, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid rate '%s', expected requests/unit like 60/m", s)
+	}
+	per, ok := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate unit '%s' in '%s', expected s, m or h", unit, s)
+	}
+	return Rate{Count: n, Per: per}, nil
+}
+
+func (r Rate) String() string {
+	if r.Count == 0 {
+		return "unlimited"
+	}
+	unit := map[time.Duration]string{time.Second: "s", time.Minute: "m", time.Hour: "h"}[r.Per]
+	if unit == "" {
+		return fmt.Sprintf("%d/%s", r.Count, r.Per)
+	}
+	return fmt.Sprintf("%d/%s", r.Count, unit)
+}
+
+// RateLimiter limits each client to a Rate with a token bucket.
+type RateLimiter struct {
+	name    string
+	rate    Rate
+	proxies TrustedProxies
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter limits clients to rate; name labels rejected requests in the metrics.
+func NewRateLimiter(name string, rate Rate, proxies TrustedProxies) *RateLimiter {
+	return &RateLimiter{name: name, rate: rate, proxies: proxies, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// perSecond is the refill rate of the buckets.
+func (l *RateLimiter) perSecond() float64 {
+	return float64(l.rate.Count) / l.rate.Per.Seconds()
+}
+
+// Allow takes a token for client, or returns false and how long until the next one.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	if l.rate.Count == 0 {
+		return true, 0
+	}
+	now := l.now()
+	burst := float64(l.rate.Count)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.perSecond())
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perSecond() * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops the full buckets at most once per period; the caller must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Per {
+		return
+	}
+	l.lastSweep = now
+	burst := float64(l.rate.Count)
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSecond() >= burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Check takes a token for the client of r, answering 429 with Retry-After if there is none.
+func (l *RateLimiter) Check(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := l.Allow(l.proxies.ClientIP(r))
+	if ok {
+		return true
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	rateLimitedRequests.Inc(l.name)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("Too many requests, retry in %d seconds", seconds), http.StatusTooManyRequests)
+	return false
+}
+
+// Middleware runs Check before every request.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l.rate.Count == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.Check(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// TrustedProxies are reverse proxies whose X-Forwarded-For and X-Real-IP headers are believed.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies reads IP addresses and CIDR ranges.
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s', expected an IP address or CIDR range", s)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+func (t TrustedProxies) trusts(addr netip.Addr) bool {
+	for _, prefix := range t {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address r is counted under, following trusted proxies; IPv6 is grouped by /64.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	peerTrusted := len(t) > 0 && (err != nil || t.trusts(addr))
+	if !peerTrusted {
+		return clientKey(addr, host)
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		if !t.trusts(hop) {
+			return clientKey(hop, "")
+		}
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return clientKey(realIP, "")
+	}
+	return clientKey(addr, host)
+}
+
+func clientKey(addr netip.Addr, fallback string) string {
+	if !addr.IsValid() {
+		return fallback
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Rate
+		wantErr bool
+	}{
+		{"60/m", Rate{60, time.Minute}, false},
+		{" 5/s ", Rate{5, time.Second}, false},
+		{"1000/h", Rate{1000, time.Hour}, false},
+		{"", Rate{}, false},
+		{"0", Rate{}, false},
+		{"60", Rate{}, true},
+		{"60/d", Rate{}, true},
+		{"-1/s", Rate{}, true},
+		{"x/s", Rate{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %v, %v; expected %v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter("test", Rate{Count: 2, Per: time.Second}, nil)
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("expected the third request to wait 500ms, got %v %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("expected another client to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("expected a token after 500ms")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Errorf("expected a single token after 500ms")
+	}
+
+	now = now.Add(time.Hour)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("expected full buckets to be swept, got %d buckets", len(l.buckets))
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	l := NewRateLimiter("test", Rate{Count: 1, Per: time.Minute}, nil)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("expected the first request to pass, got %d", w.Code)
+	}
+	w := serve()
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("expected Retry-After 60, got %q", got)
+	}
+
+	handler = NewRateLimiter("test", Rate{}, nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 10 {
+		if w := serve(); w.Code != http.StatusOK {
+			t.Fatalf("expected an unlimited limiter to pass requests through, got %d", w.Code)
+		}
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.example.com"}); err == nil {
+		t.Errorf("expected an error for a host name")
+	}
+
+	tests := []struct {
+		name      string
+		proxies   TrustedProxies
+		remote    string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"direct", proxies, "203.0.113.5:1234", nil, "", "203.0.113.5"},
+		{"untrusted peer", proxies, "203.0.113.5:1234", []string{"198.51.100.1"}, "", "203.0.113.5"},
+		{"no proxies", nil, "10.0.0.1:1234", []string{"198.51.100.1"}, "", "10.0.0.1"},
+		{"trusted proxy", proxies, "10.0.0.1:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed chain", proxies, "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 10.1.1.1"}, "", "198.51.100.1"},
+		{"split headers", proxies, "192.168.1.1:1234", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"real ip", proxies, "10.0.0.1:1234", nil, "198.51.100.2", "198.51.100.2"},
+		{"only proxies", proxies, "10.0.0.1:1234", []string{"10.0.0.2"}, "", "10.0.0.1"},
+		{"unix socket", proxies, "@", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"ipv6 network", nil, "[2001:db8:1:2:3:4:5:6]:1234", nil, "", "2001:db8:1:2::/64"},
+		{"mapped ipv4", proxies, "[::ffff:10.0.0.1]:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := tt.proxies.ClientIP(r); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
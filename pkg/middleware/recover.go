@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+const errorPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>500 Internal Server Error</title></head>
+<body>
+<h1>Internal Server Error</h1>
+<p>Something went wrong while handling your request.</p>
+<p>Request ID: <code>%s</code></p>
+</body>
+</html>
+`
+
+// writeTracker remembers whether a response was started.
+type writeTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *writeTracker) WriteHeader(statusCode int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *writeTracker) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Recover turns a panic in a handler into a logged error and a 500 page, or a closed connection.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker := &writeTracker{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			id := RequestID(r)
+			slog.Error("Panic while handling request", "err", v, "method", r.Method, "path", r.URL.Path, "requestId", id, "stack", string(debug.Stack()))
+			if tracker.written {
+				panic(http.ErrAbortHandler)
+			}
+			header := w.Header()
+			for _, key := range []string{"Content-Length", "Content-Encoding", "Location", "Set-Cookie"} {
+				header.Del(key)
+			}
+			header.Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, errorPage, html.EscapeString(id))
+		}()
+		next.ServeHTTP(tracker, r)
+	})
+}
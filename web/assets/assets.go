@@ -3,17 +3,14 @@ package assets
 import (
 	"embed"
 	"github.com/dikkadev/bangs/pkg/middleware"
-	"log/slog"
 	"net/http"
-
-	"github.com/dikkadev/prettyslog"
 )
 
 //go:embed *
 var Assets embed.FS
 
 func Handler() http.Handler {
-	logger := slog.New(prettyslog.NewPrettyslogHandler("ASSET"))
+	logger := middleware.NewLogger("ASSET")
 	stack := middleware.CreateStack(
 		middleware.Logger(logger, "asset"),
 		middleware.BlockPathEndingInSlash,
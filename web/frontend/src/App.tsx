@@ -1,6 +1,7 @@
 import { useState } from "react"
 import { Search } from "./components/search"
 import { BangsList } from "./components/bangs-list"
+import { History } from "./components/history"
 import { GithubIcon, ExternalLink } from "lucide-react"
 
 export default function Home() {
@@ -80,6 +81,11 @@ export default function Home() {
             </h2>
             <BangsList mainQuery={searchQuery} />
           </section>
+
+          {/* Search history - only rendered when the server keeps one */}
+          <section className="mt-16">
+            <History />
+          </section>
         </main>
       </div>
     </div>
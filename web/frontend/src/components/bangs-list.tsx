@@ -14,6 +14,12 @@ interface BangEntry {
   description: string
   url: string
   category: string
+  tags?: string[]
+  icon?: string
+  examples?: string[]
+  aliases?: string[] // Extra bangs resolving to this entry
+  deprecated?: boolean
+  replacement?: string
 }
 
 // Type definition for alias entries
@@ -30,9 +36,15 @@ interface AliasEntry {
 // Define the expected API response type
 interface BangsApiResponse {
   bangs: Record<string, BangEntry>
+  entries?: (BangEntry & { section?: string })[] // Same entries in registry file order
   aliases: Record<string, string>
 }
 
+// Usage report from /api/stats, only present when the server keeps statistics
+interface StatsApiResponse {
+  counts: Record<string, number> // Use count by entry name
+}
+
 // Define props type
 interface BangsListProps {
   mainQuery: string;
@@ -82,6 +94,8 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
   const [activeCategory, setActiveCategory] = useState<string | null>(null)
   const [isGridView, setIsGridView] = useState(true)
   const [categories, setCategories] = useState<string[]>([])
+  const [usageCounts, setUsageCounts] = useState<Record<string, number> | null>(null) // null if statistics are disabled
+  const [sortByUsage, setSortByUsage] = useState(false)
 
   // Fetch bangs from the API
   useEffect(() => {
@@ -93,8 +107,11 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
         }
         const data: BangsApiResponse = await response.json()
 
-        // Process bangs into an array
-        let processedList: (BangEntry | AliasEntry)[] = Object.entries(data.bangs).map(([name, entry]) => ({ ...entry, name }))
+        // Process bangs into an array, keeping the registry file order if the server sends it
+        const ordered = data.entries !== undefined
+        let processedList: (BangEntry | AliasEntry)[] = ordered
+          ? [...data.entries!]
+          : Object.entries(data.bangs).map(([name, entry]) => ({ ...entry, name }))
         
         // Process aliases and add them to the list
         if (data.aliases) {
@@ -107,11 +124,11 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
             isAlias: true,
             target: target
           }))
-          processedList = [...processedList, ...aliasEntries]
+          processedList = ordered ? [...aliasEntries, ...processedList] : [...processedList, ...aliasEntries]
         }
         
-        // Sort the list with custom category order
-        processedList.sort((a, b) => {
+        // Sort the list with custom category order, unless it already comes in file order
+        if (!ordered) processedList.sort((a, b) => {
           const categoryA = a.category || "";
           const categoryB = b.category || "";
 
@@ -145,7 +162,7 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
 
         // Update category filter buttons based on the *custom* order + remaining
         const uniqueCategories = Array.from(new Set(processedList.map((bang) => bang.category).filter(Boolean)))
-        uniqueCategories.sort((a, b) => {
+        if (!ordered) uniqueCategories.sort((a, b) => {
           const indexA = categorySortOrder.indexOf(a);
           const indexB = categorySortOrder.indexOf(b);
           if (indexA !== -1 && indexB !== -1) return indexA - indexB;
@@ -167,6 +184,21 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
     fetchBangs()
   }, [])
 
+  // Fetch usage statistics for sorting by popularity; the server answers 404 if they are disabled
+  useEffect(() => {
+    const fetchStats = async () => {
+      try {
+        const response = await fetch("/api/stats?limit=0")
+        if (!response.ok) return
+        const data: StatsApiResponse = await response.json()
+        setUsageCounts(data.counts)
+      } catch (error) {
+        console.error("Failed to fetch usage statistics:", error)
+      }
+    }
+    fetchStats()
+  }, [])
+
   const handleCopy = (entry: BangEntry | AliasEntry, name: string) => {
     let textToCopy: string;
     
@@ -213,9 +245,16 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
       (activeCategory === null || bang.category === activeCategory) &&
       (bang.name.toLowerCase().includes(searchTerm.toLowerCase()) ||
         bang.bang.toLowerCase().includes(searchTerm.toLowerCase()) ||
-        bang.description.toLowerCase().includes(searchTerm.toLowerCase())),
+        bang.description.toLowerCase().includes(searchTerm.toLowerCase()) ||
+        ('tags' in bang && bang.tags?.some((tag) => tag.toLowerCase().includes(searchTerm.toLowerCase()))) ||
+        ('aliases' in bang && bang.aliases?.some((alias) => alias.toLowerCase().includes(searchTerm.toLowerCase())))),
   )
 
+  // Most used first when sorting by popularity; sort is stable, so ties keep their order
+  if (sortByUsage && usageCounts) {
+    filteredBangs.sort((a, b) => (usageCounts[b.name] ?? 0) - (usageCounts[a.name] ?? 0))
+  }
+
   return (
     <div>
       <div className="mb-8 flex flex-wrap gap-4 items-center">
@@ -252,6 +291,17 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
           >
             List
           </Button>
+          {usageCounts && (
+            <Button
+              variant={sortByUsage ? "default" : "outline"}
+              size="sm"
+              onClick={() => setSortByUsage(!sortByUsage)}
+              className={`${sortByUsage ? "bg-pink-500 hover:bg-pink-600" : "border-white/20 text-white bg-black hover:bg-white/10"}`}
+              aria-label="Sort by popularity"
+            >
+              Popular
+            </Button>
+          )}
         </div>
       </div>
 
@@ -294,8 +344,12 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
                 <div className={`absolute top-0 left-0 w-1 h-full opacity-0 group-hover:opacity-100 transition-opacity ${isAlias ? 'bg-purple-500' : 'bg-pink-500'}`}></div>
                 <div className="flex justify-between items-start mb-2">
                   <h3 className={`font-bold text-white group-hover:transition-colors ${isAlias ? 'group-hover:text-purple-500' : 'group-hover:text-pink-500'}`}>
+                    {'icon' in bang && bang.icon && <img src={bang.icon} alt="" className="inline h-4 w-4 mr-2 align-[-2px]" loading="lazy" />}
                     {bang.name}
                     {isAlias && <span className="ml-1 text-xs text-purple-400">alias</span>}
+                    {'deprecated' in bang && bang.deprecated && (
+                      <span className="ml-1 text-xs text-gray-500">deprecated{bang.replacement ? `, use !${bang.replacement}` : ""}</span>
+                    )}
                   </h3>
                   <span className={`font-mono text-sm ${isAlias ? 'text-purple-500' : 'text-pink-500'}`}>{bang.bang}</span>
                 </div>
@@ -357,8 +411,12 @@ export function BangsList({ mainQuery }: BangsListProps) { // Destructure props
                 <div className="p-4 flex-grow">
                   <div className="flex items-center gap-2 mb-1">
                     <h3 className={`font-bold text-white group-hover:transition-colors ${isAlias ? 'group-hover:text-purple-500' : 'group-hover:text-pink-500'}`}>
+                      {'icon' in bang && bang.icon && <img src={bang.icon} alt="" className="inline h-4 w-4 mr-2 align-[-2px]" loading="lazy" />}
                       {bang.name}
                       {isAlias && <span className="ml-1 text-xs text-purple-400">alias</span>}
+                      {'deprecated' in bang && bang.deprecated && (
+                        <span className="ml-1 text-xs text-gray-500">deprecated{bang.replacement ? `, use !${bang.replacement}` : ""}</span>
+                      )}
                     </h3>
                     <span className={`font-mono text-sm ${isAlias ? 'text-purple-500' : 'text-pink-500'}`}>{bang.bang}</span>
                   </div>
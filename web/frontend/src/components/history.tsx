@@ -0,0 +1,190 @@
+"use client"
+
+import { useState, useEffect, useCallback } from "react"
+import { Input } from "@/components/ui/input"
+import { Button } from "@/components/ui/button"
+import { Search, Trash2, Download, ExternalLink } from "lucide-react"
+import { toast } from "@/components/ui/use-toast"
+
+// One resolved search; query and urls are missing in private mode
+interface HistoryEntry {
+  id: number
+  time: string
+  bang?: string
+  query?: string
+  urls?: string[]
+}
+
+interface HistoryApiResponse {
+  private: boolean
+  entries: HistoryEntry[]
+}
+
+// The history API needs the admin token unless the browser runs on the same machine
+const tokenKey = "bangs-admin-token"
+
+export function History() {
+  const [entries, setEntries] = useState<HistoryEntry[]>([])
+  const [privateMode, setPrivateMode] = useState(false)
+  const [filter, setFilter] = useState("")
+  const [token, setToken] = useState(() => localStorage.getItem(tokenKey) ?? "")
+  const [status, setStatus] = useState<"loading" | "ok" | "disabled" | "unauthorized">("loading")
+
+  const request = useCallback((path: string, method = "GET") => {
+    const headers: Record<string, string> = {}
+    if (token) headers["Authorization"] = `Bearer ${token}`
+    return fetch(`/api/history${path}`, { method, headers })
+  }, [token])
+
+  // Fetch the history; the server answers 404 if it is disabled
+  const fetchHistory = useCallback(async () => {
+    try {
+      const response = await request(`?q=${encodeURIComponent(filter)}`)
+      if (response.status === 401 || response.status === 403) {
+        setStatus("unauthorized")
+        return
+      }
+      if (!response.ok) {
+        setStatus("disabled")
+        return
+      }
+      const data: HistoryApiResponse = await response.json()
+      setEntries(data.entries)
+      setPrivateMode(data.private)
+      setStatus("ok")
+    } catch (error) {
+      console.error("Failed to fetch search history:", error)
+      setStatus("disabled")
+    }
+  }, [request, filter])
+
+  useEffect(() => {
+    fetchHistory()
+  }, [fetchHistory])
+
+  const saveToken = (value: string) => {
+    localStorage.setItem(tokenKey, value)
+    setToken(value)
+  }
+
+  const handleDelete = async (id: number) => {
+    const response = await request(`/${id}`, "DELETE")
+    if (!response.ok) {
+      toast({ variant: "destructive", title: "Error deleting search", description: await response.text() })
+      return
+    }
+    setEntries(entries.filter((entry) => entry.id !== id))
+  }
+
+  const handlePurge = async () => {
+    if (!window.confirm("Delete the whole search history?")) return
+    const response = await request("", "DELETE")
+    if (!response.ok) {
+      toast({ variant: "destructive", title: "Error purging history", description: await response.text() })
+      return
+    }
+    setEntries([])
+    toast({ title: "History purged", duration: 3000 })
+  }
+
+  // Downloads go through fetch so the token can be sent along
+  const handleExport = async (format: "json" | "csv") => {
+    const response = await request(`?q=${encodeURIComponent(filter)}&format=${format}`)
+    if (!response.ok) {
+      toast({ variant: "destructive", title: "Error exporting history", description: await response.text() })
+      return
+    }
+    const link = document.createElement("a")
+    link.href = URL.createObjectURL(await response.blob())
+    link.download = `bangs-history.${format}`
+    link.click()
+    URL.revokeObjectURL(link.href)
+  }
+
+  if (status === "loading" || status === "disabled") return null
+
+  if (status === "unauthorized") {
+    return (
+      <div className="max-w-md">
+        <p className="text-sm text-gray-400 mb-3">Enter the admin token to see the search history.</p>
+        <Input
+          type="password"
+          placeholder="Admin token"
+          onKeyDown={(e) => e.key === "Enter" && saveToken(e.currentTarget.value)}
+          className="bg-black border-white/20 text-white placeholder:text-gray-500 focus:border-pink-500 focus:ring-1 focus:ring-pink-500"
+          aria-label="Admin token"
+        />
+      </div>
+    )
+  }
+
+  return (
+    <div>
+      <div className="mb-6 flex flex-wrap gap-4 items-center">
+        <div className="relative flex-grow max-w-md">
+          <div className="absolute left-3 top-1/2 transform -translate-y-1/2 text-pink-500">
+            <Search className="h-4 w-4" />
+          </div>
+          <Input
+            type="text"
+            placeholder="Filter history..."
+            value={filter}
+            onChange={(e) => setFilter(e.target.value)}
+            className="pl-10 bg-black border-white/20 text-white placeholder:text-gray-500 focus:border-pink-500 focus:ring-1 focus:ring-pink-500"
+            aria-label="Filter history"
+          />
+        </div>
+        <div className="flex gap-2">
+          <Button variant="outline" size="sm" onClick={() => handleExport("json")} className="border-white/20 text-white bg-black hover:bg-white/10">
+            <Download className="h-4 w-4 mr-1" /> JSON
+          </Button>
+          <Button variant="outline" size="sm" onClick={() => handleExport("csv")} className="border-white/20 text-white bg-black hover:bg-white/10">
+            <Download className="h-4 w-4 mr-1" /> CSV
+          </Button>
+          <Button variant="outline" size="sm" onClick={handlePurge} className="border-white/20 text-white bg-black hover:bg-pink-500 hover:border-pink-500" disabled={!entries.length}>
+            Purge
+          </Button>
+        </div>
+      </div>
+
+      {privateMode && <p className="text-xs text-gray-500 mb-4">Private mode: only the time and bang of searches are kept.</p>}
+
+      {entries.length === 0 ? (
+        <p className="text-sm text-gray-500">{filter ? "No searches match the filter." : "No searches yet."}</p>
+      ) : (
+        <div className="border border-white/10">
+          {entries.map((entry) => (
+            <div key={entry.id} className="group flex items-center gap-4 border-b border-white/10 last:border-b-0 px-4 py-2 hover:bg-white/5">
+              <span className="text-xs text-gray-500 font-mono shrink-0">{new Date(entry.time).toLocaleString()}</span>
+              <span className="font-mono text-sm text-pink-500 shrink-0">{entry.bang ? `!${entry.bang}` : "default"}</span>
+              <span className="text-sm text-white truncate flex-grow">{entry.query}</span>
+              <div className="flex space-x-1 shrink-0">
+                {entry.urls?.map((url) => (
+                  <Button
+                    key={url}
+                    variant="outline"
+                    size="icon"
+                    className="h-8 w-8 border-white/10 hover:bg-pink-500 hover:text-white hover:border-pink-500 cursor-pointer"
+                    onClick={() => window.open(url, "_blank", "noopener,noreferrer")}
+                    aria-label={`Open ${url}`}
+                  >
+                    <ExternalLink className="h-4 w-4" />
+                  </Button>
+                ))}
+                <Button
+                  variant="outline"
+                  size="icon"
+                  className="h-8 w-8 border-white/10 hover:bg-pink-500 hover:text-white hover:border-pink-500 cursor-pointer"
+                  onClick={() => handleDelete(entry.id)}
+                  aria-label="Delete from history"
+                >
+                  <Trash2 className="h-4 w-4" />
+                </Button>
+              </div>
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  )
+}
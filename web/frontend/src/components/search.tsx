@@ -2,8 +2,7 @@
 
 import type React from "react"
 
-// Remove unused useState import
-// import { useState } from "react"
+import { useState, useEffect } from "react"
 import { SearchIcon, ArrowRightIcon } from "lucide-react"
 import { Input } from "@/components/ui/input"
 import { Button } from "@/components/ui/button"
@@ -14,7 +13,33 @@ interface SearchProps {
   onQueryChange: (query: string) => void;
 }
 
+// Bang suggestion from /api/complete
+interface Completion {
+  bang: string
+  name: string
+  description?: string
+  category?: string
+  alias?: boolean
+}
+
 export function Search({ query, onQueryChange }: SearchProps) {
+  const [completions, setCompletions] = useState<Completion[]>([])
+
+  // Suggest bangs while the first word of a bang query is typed
+  useEffect(() => {
+    const match = query.match(/^!(\S+)$/)
+    if (!match) {
+      setCompletions([])
+      return
+    }
+    const controller = new AbortController()
+    fetch(`/api/complete?prefix=${encodeURIComponent(match[1])}&limit=8`, { signal: controller.signal })
+      .then((response) => (response.ok ? response.json() : { completions: [] }))
+      .then((data: { completions: Completion[] }) => setCompletions(data.completions))
+      .catch(() => {}) // Aborted by the next keystroke or unavailable
+    return () => controller.abort()
+  }, [query])
+
   const handleSearch = (e: React.FormEvent) => {
     e.preventDefault()
 
@@ -67,6 +92,23 @@ export function Search({ query, onQueryChange }: SearchProps) {
             <ArrowRightIcon className="h-4 w-4" />
           </Button>
         </div>
+        {completions.length > 0 && (
+          <ul className="absolute left-0 right-0 top-full z-30 mt-1 border border-white/20 bg-black" role="listbox">
+            {completions.map((c) => (
+              <li key={c.bang}>
+                <button
+                  type="button"
+                  onClick={() => onQueryChange(`!${c.bang} `)}
+                  className="w-full flex items-baseline gap-3 px-4 py-2 text-left hover:bg-white/10"
+                >
+                  <span className={`font-mono text-sm ${c.alias ? "text-purple-500" : "text-pink-500"}`}>!{c.bang}</span>
+                  <span className="text-sm text-white">{c.name}</span>
+                  <span className="text-xs text-gray-500 truncate">{c.category ? `${c.category} · ` : ""}{c.description}</span>
+                </button>
+              </li>
+            ))}
+          </ul>
+        )}
       </form>
       <div className="mt-4 text-sm text-gray-400 flex items-center">
         <div className="w-4 h-4 rounded-full bg-pink-500/20 border border-pink-500/50 mr-2 flex items-center justify-center">